@@ -0,0 +1,172 @@
+package mini
+
+import (
+	"errors"
+	"math/big"
+)
+
+// ErrMemoryLimit is returned when an evaluation allocates more than
+// Vm.MaxAlloc bytes
+var ErrMemoryLimit = errors.New("memory limit exceeded")
+
+// Approximate sizes in bytes of the memory the builtin types allocate
+const (
+	sizeHeader = 24 // a container, or a string or big number header
+	sizeSlot   = 16 // a list item
+	sizeEntry  = 64 // a map entry and its index
+)
+
+// meter accounts for the memory allocated by an evaluation. A nil meter
+// accounts for nothing.
+type meter struct {
+	limit int64
+	used  int64
+}
+
+// charge accounts for n bytes, failing with ErrMemoryLimit if they would
+// exceed the limit
+func (m *meter) charge(n int64) error {
+	if m == nil {
+		return nil
+	}
+	if m.exceeds(n) {
+		return ErrMemoryLimit
+	}
+	m.used += n
+	return nil
+}
+
+// chargeBig accounts for a big number of the given bit length
+func (m *meter) chargeBig(bits int) error {
+	return m.charge(sizeHeader + int64(bits)/8 + 1)
+}
+
+// meteredSender is implemented by the builtin types whose operations
+// allocate. sendMetered is Send, accounting for allocations with m.
+type meteredSender interface {
+	sendMetered(m *meter, op Op, args Args) (Object, error)
+}
+
+// sendWith sends op to lhs, accounting for allocations with m if lhs
+// supports it
+func sendWith(m *meter, lhs Object, op Op, args Args) (Object, error) {
+	if s, ok := lhs.(meteredSender); ok {
+		return s.sendMetered(m, op, args)
+	}
+	return lhs.Send(op, args)
+}
+
+// adopt attaches the meter of vm to obj if it is a container which has none,
+// accounting for its current size. Containers grow through their meter.
+func (vm *Vm) adopt(obj Object) error {
+	switch o := obj.(type) {
+	case *List:
+		if o.meter == nil {
+			o.meter = &vm.meter
+			return o.meter.charge(sizeHeader + sizeSlot*int64(len(o.Items)))
+		}
+	case *Map:
+		if o.meter == nil {
+			o.meter = &vm.meter
+			return o.meter.charge(sizeHeader + sizeEntry*int64(len(o.entries)))
+		}
+	}
+	return nil
+}
+
+// account accounts for obj, which was returned by a native function and so
+// may have been allocated without a meter
+func (vm *Vm) account(obj Object) error {
+	switch o := obj.(type) {
+	case String:
+		return vm.meter.charge(sizeHeader + int64(len(o)))
+	case BigInt:
+		return vm.meter.chargeBig(o.val.BitLen())
+	case Decimal:
+		return vm.meter.chargeBig(ratBitLen(o.val))
+	}
+	return vm.adopt(obj)
+}
+
+// ratBitLen returns the combined bit length of the numerator and
+// denominator of x
+func ratBitLen(x *big.Rat) int {
+	return x.Num().BitLen() + x.Denom().BitLen()
+}
+
+// powBitLen estimates the bit length of a number of the given bit length
+// raised to the power n. It is exact for powers of two, and at most the
+// actual bit length otherwise.
+func powBitLen(bits int, n *big.Int) int {
+	if bits <= 1 || n.Sign() <= 0 {
+		return bits
+	}
+	if !n.IsInt64() || n.Int64() > int64(maxInt/(bits-1)) {
+		return maxInt
+	}
+	return (bits-1)*int(n.Int64()) + 1
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// Limits on the size of the result of a single operation. They apply even
+// without a memory limit, since an operation is computed in a single step
+// which neither Vm.MaxSteps nor a deadline can interrupt. Decimals are
+// limited more tightly than BigInts, since each Decimal operation reduces
+// its result to lowest terms, which takes time quadratic in its length.
+const (
+	maxBigIntBits  = 1 << 23
+	maxDecimalBits = 1 << 16
+	maxStringLen   = 1 << 24
+)
+
+// errStringTooLong is returned by an operation whose result would be longer
+// than maxStringLen bytes
+var errStringTooLong = errors.New("ValueError: string too long")
+
+// exceeds returns true if n more bytes would exceed the limit
+func (m *meter) exceeds(n int64) bool {
+	return m != nil && m.limit > 0 && n > m.limit-m.used
+}
+
+// refuse returns err for a result of n bytes which is too large to compute,
+// or ErrMemoryLimit if it would also exceed the limit
+func (m *meter) refuse(n int64, err error) error {
+	if m.exceeds(n) {
+		return ErrMemoryLimit
+	}
+	return err
+}
+
+// checkBig fails with ErrOverflow if a big number of the given bit length is
+// longer than max bits. It accounts for nothing.
+func (m *meter) checkBig(bits, max int) error {
+	if bits > max {
+		return m.refuse(sizeHeader+int64(bits)/8+1, ErrOverflow)
+	}
+	return nil
+}
+
+// chargeString accounts for a string of n bytes, failing with
+// errStringTooLong if it is longer than maxStringLen
+func (m *meter) chargeString(n int) error {
+	if n > maxStringLen {
+		return m.refuse(sizeHeader+int64(n), errStringTooLong)
+	}
+	return m.charge(sizeHeader + int64(n))
+}
+
+// Stats describes the resources used by the current or most recent
+// evaluation of a Vm
+type Stats struct {
+	// Steps is the number of loop iterations and function calls, including
+	// calls to native functions
+	Steps int64
+	// Allocated is the approximate number of bytes allocated
+	Allocated int64
+}
+
+// Stats returns the resources used by the current or most recent evaluation
+func (vm *Vm) Stats() Stats {
+	return Stats{Steps: vm.steps, Allocated: vm.meter.used}
+}
@@ -7,14 +7,21 @@ import (
 )
 
 var (
-	boolType   reflect.Type = reflect.TypeOf(Bool(false))
-	funcType   reflect.Type = reflect.TypeOf(Function(nil))
-	numberType reflect.Type = reflect.TypeOf(Number(0))
-	stringType reflect.Type = reflect.TypeOf(String(""))
+	bigIntType  reflect.Type = reflect.TypeOf(BigInt{})
+	boolType    reflect.Type = reflect.TypeOf(Bool(false))
+	decimalType reflect.Type = reflect.TypeOf(Decimal{})
+	funcType    reflect.Type = reflect.TypeOf(Function(nil))
+	intType     reflect.Type = reflect.TypeOf(Int(0))
+	lambdaType  reflect.Type = reflect.TypeOf((*Lambda)(nil))
+	listType    reflect.Type = reflect.TypeOf((*List)(nil))
+	mapType     reflect.Type = reflect.TypeOf((*Map)(nil))
+	numberType  reflect.Type = reflect.TypeOf(Number(0))
+	stringType  reflect.Type = reflect.TypeOf(String(""))
 )
 
 var (
 	ErrZeroDivision = errors.New("Divide by zero")
+	ErrOverflow     = errors.New("Integer overflow")
 )
 
 func NewErrInvalidOp(op Op, obj Object) error {
@@ -31,6 +38,10 @@ func newErrTypeBadRhs(op Op, lhs, rhs interface{}, rhsType reflect.Type) error {
 	)
 }
 
+func newErrIndexOutOfRange(idx Object, length int) error {
+	return fmt.Errorf("IndexError: index %v out of range for length %d", idx, length)
+}
+
 func newTypeError(arg int, want reflect.Type, have interface{}) error {
-	return nil // FIXME implement
+	return fmt.Errorf("TypeError: expected argument %d to be %v, got %T", arg, want, have)
 }
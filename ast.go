@@ -4,18 +4,56 @@ type Expression interface {
 	Eval(*Vm) (Object, error)
 }
 
-type Tree struct {
-	Children []Expression
+// Span is the extent of an expression in the source, from the start of its
+// first token to the end of its last
+type Span struct {
+	Start Position
+	End   Position
 }
 
-func (e *Tree) Eval(vm *Vm) (obj Object, err error) {
-	for _, expr := range e.Children {
-		obj, err = expr.Eval(vm)
-		if err != nil {
-			break
-		}
+// SourceSpan helps the AST nodes implement the Spanned interface
+func (s Span) SourceSpan() Span { return s }
+
+func (s *Span) setSpan(span Span) { *s = span }
+
+// Spanned is implemented by expressions which know where they are in the
+// source. Every node the parser produces is Spanned.
+type Spanned interface {
+	Expression
+	SourceSpan() Span
+}
+
+// SpanOf returns the span of expr, or the zero Span if it has none
+func SpanOf(expr Expression) Span {
+	if e, ok := expr.(Spanned); ok {
+		return e.SourceSpan()
 	}
-	return
+	return Span{}
+}
+
+type Tree struct {
+	Span
+	Exprs []Expression
+}
+
+func (e *Tree) Eval(vm *Vm) (Object, error) {
+	return evalSequence(e.Exprs, vm)
+}
+
+// Block is a sequence of expressions evaluated in a new scope
+type Block struct {
+	Span
+	Exprs []Expression
+}
+
+func (e *Block) Eval(vm *Vm) (Object, error) {
+	return e.evalIn(NewScope(vm.scope), vm)
+}
+
+func (e *Block) evalIn(scope *Scope, vm *Vm) (Object, error) {
+	prev := vm.swapScope(scope)
+	defer vm.swapScope(prev)
+	return evalSequence(e.Exprs, vm)
 }
 
 type ConditionalBlock struct {
@@ -24,13 +62,14 @@ type ConditionalBlock struct {
 }
 
 type IfExpr struct {
+	Span
 	If   ConditionalBlock
 	Else ConditionalBlock
 }
 
 func (e *IfExpr) Eval(vm *Vm) (Object, error) {
 	didEval, obj, err := evalBranch(e.If, vm)
-	if !didEval || err != nil {
+	if didEval || err != nil {
 		return obj, err
 	}
 	_, obj, err = evalBranch(e.Else, vm)
@@ -38,7 +77,9 @@ func (e *IfExpr) Eval(vm *Vm) (Object, error) {
 }
 
 type ForExpr struct {
-	For ConditionalBlock
+	Span
+	Label string
+	For   ConditionalBlock
 }
 
 func (e *ForExpr) Eval(vm *Vm) (Object, error) {
@@ -46,35 +87,145 @@ func (e *ForExpr) Eval(vm *Vm) (Object, error) {
 		obj Object
 		err error
 	)
+	if e.For.Condition == nil {
+		return NIL, nil
+	}
 	for {
+		if err = vm.step(); err != nil {
+			break
+		}
 		var didEval bool
 		didEval, obj, err = evalBranch(e.For, vm)
-		if err != nil || !didEval {
+		if err != nil || !didEval || vm.catchLoopControl(e.Label) {
+			break
+		}
+	}
+	return obj, err
+}
+
+// ForInExpr is a loop over the elements of an Iterable. Key, which may be
+// empty, and Value are bound in a fresh scope for each element.
+type ForInExpr struct {
+	Span
+	Label string
+	Key   Symbol
+	Value Symbol
+	Iter  Expression
+	Body  *Block
+}
+
+func (e *ForInExpr) Eval(vm *Vm) (Object, error) {
+	obj, err := e.Iter.Eval(vm)
+	if err != nil || vm.unwinding() {
+		return obj, err
+	}
+	it, err := iterate(obj)
+	if err != nil {
+		return nil, wrapError(err, SpanOf(e.Iter).Start, SpanOf(e.Iter))
+	}
+	for it.Next() {
+		if err = vm.step(); err != nil {
+			break
+		}
+		scope := NewScope(vm.scope)
+		if e.Key != "" {
+			scope.Define(e.Key, it.Key())
+		}
+		scope.Define(e.Value, it.Value())
+		if _, err = e.Body.evalIn(scope, vm); err != nil || vm.catchLoopControl(e.Label) {
 			break
 		}
 	}
+	return NIL, err
+}
+
+// TryExpr evaluates Body, and Catch with the error bound to Name if Body
+// fails. Finally, if present, is always evaluated last.
+type TryExpr struct {
+	Span
+	Body    *Block
+	Name    Symbol
+	Catch   *Block
+	Finally *Block
+}
+
+func (e *TryExpr) Eval(vm *Vm) (Object, error) {
+	obj, err := e.Body.Eval(vm)
+	if err != nil && e.Catch != nil && !isFatal(err) {
+		setFile(err, vm.file)
+		scope := NewScope(vm.scope)
+		if e.Name != "" {
+			scope.Define(e.Name, asError(err))
+		}
+		obj, err = e.Catch.evalIn(scope, vm)
+	}
+	if err != nil && isFatal(err) {
+		return nil, err
+	}
+	if e.Finally != nil {
+		// a pending exit resumes after the finally block, unless it raises
+		// an error or exits itself
+		pending := vm.control
+		vm.control = control{}
+		if _, ferr := e.Finally.Eval(vm); ferr != nil || vm.unwinding() {
+			return NIL, ferr
+		}
+		vm.control = pending
+	}
 	return obj, err
 }
 
+type BreakExpr struct {
+	Span
+	Label string
+}
+
+func (e *BreakExpr) Eval(vm *Vm) (Object, error) {
+	vm.control = control{kind: controlBreak, label: e.Label}
+	return NIL, nil
+}
+
+type ContinueExpr struct {
+	Span
+	Label string
+}
+
+func (e *ContinueExpr) Eval(vm *Vm) (Object, error) {
+	vm.control = control{kind: controlContinue, label: e.Label}
+	return NIL, nil
+}
+
 type AssignExpr struct {
+	Span
 	Name Symbol
 	Expr Expression
+	Pos  Position
 }
 
 func (e *AssignExpr) Eval(vm *Vm) (obj Object, err error) {
 	obj, err = e.Expr.Eval(vm)
-	if err == nil {
+	if err == nil && !vm.unwinding() {
 		vm.Assign(e.Name, obj)
 	}
 	return
 }
 
 type CallExpr struct {
-	Name Symbol
+	Span
+	Func Expression
 	Args []Expression
+	Pos  Position
 }
 
 func (e *CallExpr) Eval(vm *Vm) (Object, error) {
+	obj, err := e.Func.Eval(vm)
+	if err != nil || vm.unwinding() {
+		return obj, err
+	}
+	fn, ok := obj.(Callable)
+	if !ok {
+		return nil, wrapError(notFunctionError(e.Func, obj), e.Pos, e.Span)
+	}
 	args := make([]Object, len(e.Args))
 	for i, expr := range e.Args {
 		var err error
@@ -82,8 +233,140 @@ func (e *CallExpr) Eval(vm *Vm) (Object, error) {
 		if err != nil {
 			return nil, err
 		}
+		if vm.unwinding() {
+			return args[i], nil
+		}
+	}
+	depth := vm.enterSite(e.Func, e.Pos, vm.file)
+	ret, err := vm.callFunction(fn, args)
+	if err != nil {
+		err = vm.callError(err, e.Pos, e.Span)
 	}
-	return vm.Call(e.Name, args)
+	vm.sites = vm.sites[:depth]
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fn.(*Lambda); !ok {
+		if err := vm.account(ret); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+type SelectorExpr struct {
+	Span
+	Base Expression
+	Name string
+	Pos  Position
+}
+
+func (e *SelectorExpr) Eval(vm *Vm) (Object, error) {
+	obj, err := e.Base.Eval(vm)
+	if err != nil || vm.unwinding() {
+		return obj, err
+	}
+	if err := vm.adopt(obj); err != nil {
+		return nil, err
+	}
+	fn, err := lookupMethod(obj, e.Name)
+	if err != nil {
+		return nil, wrapError(err, e.Pos, e.Span)
+	}
+	return fn, nil
+}
+
+type FuncExpr struct {
+	Span
+	Params []Symbol
+	Body   *Block
+}
+
+func (e *FuncExpr) Eval(vm *Vm) (Object, error) {
+	return &Lambda{Params: e.Params, Body: e.Body, env: vm.scope, vm: vm}, nil
+}
+
+type ReturnExpr struct {
+	Span
+	Expr Expression
+}
+
+func (e *ReturnExpr) Eval(vm *Vm) (Object, error) {
+	var obj Object = NIL
+	if e.Expr != nil {
+		var err error
+		obj, err = e.Expr.Eval(vm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	vm.control = control{kind: controlReturn, value: obj}
+	return obj, nil
+}
+
+type ListExpr struct {
+	Span
+	Items []Expression
+}
+
+func (e *ListExpr) Eval(vm *Vm) (Object, error) {
+	items := make([]Object, len(e.Items))
+	for i, expr := range e.Items {
+		var err error
+		items[i], err = expr.Eval(vm)
+		if err != nil || vm.unwinding() {
+			return items[i], err
+		}
+	}
+	list := NewList(items...)
+	return list, vm.adopt(list)
+}
+
+type MapExpr struct {
+	Span
+	Keys   []Expression
+	Values []Expression
+}
+
+func (e *MapExpr) Eval(vm *Vm) (Object, error) {
+	m := NewMap()
+	if err := vm.adopt(m); err != nil {
+		return nil, err
+	}
+	for i, expr := range e.Keys {
+		key, err := expr.Eval(vm)
+		if err != nil || vm.unwinding() {
+			return key, err
+		}
+		val, err := e.Values[i].Eval(vm)
+		if err != nil || vm.unwinding() {
+			return val, err
+		}
+		if err := m.Set(key, val); err != nil {
+			return nil, wrapError(err, SpanOf(expr).Start, SpanOf(expr))
+		}
+	}
+	return m, nil
+}
+
+// Ident is a reference to the value bound to Name
+type Ident struct {
+	Span
+	Name Symbol
+}
+
+func (e *Ident) Eval(vm *Vm) (Object, error) {
+	return e.Name.Eval(vm)
+}
+
+// Literal is a constant written in the source
+type Literal struct {
+	Span
+	Value Object
+}
+
+func (e *Literal) Eval(vm *Vm) (Object, error) {
+	return e.Value, nil
 }
 
 type Symbol string
@@ -97,6 +380,7 @@ func (e Symbol) Eval(vm *Vm) (Object, error) {
 }
 
 type NotExpr struct {
+	Span
 	Expr Expression
 }
 
@@ -105,8 +389,8 @@ func (e NotExpr) Eval(vm *Vm) (Object, error) {
 		return NIL, nil
 	}
 	obj, err := e.Expr.Eval(vm)
-	if err != nil {
-		return nil, err
+	if err != nil || vm.unwinding() {
+		return obj, err
 	}
 	return Bool(!obj.Truthy()), nil
 }
@@ -114,6 +398,7 @@ func (e NotExpr) Eval(vm *Vm) (Object, error) {
 // FIXME rename LHS => Lhs
 // FIXME rename RHS => Rhs
 type AndExpr struct {
+	Span
 	LHS Expression
 	RHS Expression
 }
@@ -124,16 +409,16 @@ func (e AndExpr) Eval(vm *Vm) (Object, error) {
 		return NIL, nil
 	}
 	obj, err := e.LHS.Eval(vm)
-	if err != nil {
-		return nil, err
+	if err != nil || vm.unwinding() {
+		return obj, err
 	}
 	if !obj.Truthy() {
 		// short circuit if possible
 		return obj, nil
 	}
 	obj, err = e.RHS.Eval(vm)
-	if err != nil {
-		return nil, err
+	if err != nil || vm.unwinding() {
+		return obj, err
 	}
 	if !obj.Truthy() {
 		return FALSE, nil
@@ -144,6 +429,7 @@ func (e AndExpr) Eval(vm *Vm) (Object, error) {
 // FIXME rename LHS => Lhs
 // FIXME rename RHS => Rhs
 type OrExpr struct {
+	Span
 	LHS Expression
 	RHS Expression
 }
@@ -154,16 +440,16 @@ func (e OrExpr) Eval(vm *Vm) (Object, error) {
 		return NIL, nil
 	}
 	lhs, err := e.LHS.Eval(vm)
-	if err != nil {
-		return nil, err
+	if err != nil || vm.unwinding() {
+		return lhs, err
 	}
 	if lhs.Truthy() {
 		// short circuit if possible
 		return lhs, nil
 	}
 	rhs, err := e.RHS.Eval(vm)
-	if err != nil {
-		return nil, err
+	if err != nil || vm.unwinding() {
+		return rhs, err
 	}
 	if rhs.Truthy() {
 		return rhs, nil
@@ -172,32 +458,47 @@ func (e OrExpr) Eval(vm *Vm) (Object, error) {
 }
 
 type OpExpr struct {
+	Span
 	Base Expression
 	Args []Expression
 	Op   Op
+	Pos  Position
 }
 
 func (e OpExpr) Eval(vm *Vm) (Object, error) {
 	lhs, err := e.Base.Eval(vm)
-	if err != nil {
+	if err != nil || vm.unwinding() {
+		return lhs, err
+	}
+	if err := vm.adopt(lhs); err != nil {
 		return nil, err
 	}
 	var args Args
 	for _, expr := range e.Args {
 		obj, err := expr.Eval(vm)
-		if err != nil {
-			return nil, err
+		if err != nil || vm.unwinding() {
+			return obj, err
 		}
 		args = append(args, obj) // FIXME implement args.Append or args.Push?
 	}
-	ret, err := lhs.Send(e.Op, args)
+	ret, err := sendWith(&vm.meter, lhs, e.Op, args)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err, e.Pos, e.Span)
 	}
 	if ret == nil {
-		return nil, NewErrInvalidOp(e.Op, lhs)
+		return nil, wrapError(NewErrInvalidOp(e.Op, lhs), e.Pos, e.Span)
 	}
-	return ret, nil
+	return ret, vm.adopt(ret)
+}
+
+func evalSequence(exprs []Expression, vm *Vm) (obj Object, err error) {
+	for _, expr := range exprs {
+		obj, err = expr.Eval(vm)
+		if err != nil || vm.unwinding() {
+			break
+		}
+	}
+	return
 }
 
 func evalBranch(cb ConditionalBlock, vm *Vm) (bool, Object, error) {
@@ -205,9 +506,17 @@ func evalBranch(cb ConditionalBlock, vm *Vm) (bool, Object, error) {
 		return false, NIL, nil
 	}
 	obj, err := cb.Condition.Eval(vm)
-	if err != nil || !obj.Truthy() {
+	if err != nil {
 		return false, NIL, err
 	}
+	if vm.unwinding() {
+		// the condition exited early; treat the branch as taken so that
+		// no other branch is evaluated
+		return true, obj, nil
+	}
+	if !obj.Truthy() {
+		return false, NIL, nil
+	}
 	if cb.Block == nil {
 		return false, NIL, nil
 	}
@@ -7,12 +7,20 @@ import (
 
 func (e Tree) String() string {
 	var children []string
-	for _, child := range e.Children {
+	for _, child := range e.Exprs {
 		children = append(children, fmt.Sprint(child))
 	}
 	return fmt.Sprint("Tree[", strings.Join(children, " "), "]")
 }
 
+func (e Block) String() string {
+	var children []string
+	for _, child := range e.Exprs {
+		children = append(children, fmt.Sprint(child))
+	}
+	return fmt.Sprint("Block[", strings.Join(children, " "), "]")
+}
+
 func (cb ConditionalBlock) String() string {
 	return fmt.Sprint("Cond(", cb.Condition, "=>", cb.Block, ")")
 }
@@ -22,15 +30,92 @@ func (e IfExpr) String() string {
 }
 
 func (e ForExpr) String() string {
+	if e.Label != "" {
+		return fmt.Sprint(e.Label, ":For(", e.For, ")")
+	}
 	return fmt.Sprint("For(", e.For, ")")
 }
 
+func (e ForInExpr) String() string {
+	vars := e.Value.String()
+	if e.Key != "" {
+		vars = e.Key.String() + " " + vars
+	}
+	s := fmt.Sprint("ForIn(", vars, " in ", e.Iter, " ", e.Body, ")")
+	if e.Label != "" {
+		return e.Label + ":" + s
+	}
+	return s
+}
+
+func (e TryExpr) String() string {
+	s := fmt.Sprint("Try(", e.Body)
+	if e.Catch != nil && e.Name != "" {
+		s += fmt.Sprint(" Catch(", e.Name, " ", e.Catch, ")")
+	} else if e.Catch != nil {
+		s += fmt.Sprint(" Catch(", e.Catch, ")")
+	}
+	if e.Finally != nil {
+		s += fmt.Sprint(" Finally(", e.Finally, ")")
+	}
+	return s + ")"
+}
+
+func (e BreakExpr) String() string {
+	if e.Label != "" {
+		return fmt.Sprint("Break(", e.Label, ")")
+	}
+	return "Break"
+}
+
+func (e ContinueExpr) String() string {
+	if e.Label != "" {
+		return fmt.Sprint("Continue(", e.Label, ")")
+	}
+	return "Continue"
+}
+
 func (e AssignExpr) String() string {
 	return fmt.Sprint(e.Name, "=", e.Expr)
 }
 
 func (e CallExpr) String() string {
-	return fmt.Sprint(e.Name, e.Args)
+	return fmt.Sprint(e.Func) + fmt.Sprint(e.Args)
+}
+
+func (e SelectorExpr) String() string {
+	return fmt.Sprint(e.Base, ".", e.Name)
+}
+
+func (e FuncExpr) String() string {
+	return fmt.Sprint("Func", e.Params, e.Body)
+}
+
+func (e ReturnExpr) String() string {
+	if e.Expr != nil {
+		return fmt.Sprint("Return[", e.Expr, "]")
+	}
+	return "Return"
+}
+
+func (e ListExpr) String() string {
+	return fmt.Sprint("List", e.Items)
+}
+
+func (e MapExpr) String() string {
+	var entries []string
+	for i, key := range e.Keys {
+		entries = append(entries, fmt.Sprint(key, ":", e.Values[i]))
+	}
+	return fmt.Sprint("Map[", strings.Join(entries, " "), "]")
+}
+
+func (e Ident) String() string {
+	return e.Name.String()
+}
+
+func (e Literal) String() string {
+	return fmt.Sprint(e.Value)
 }
 
 func (e Symbol) String() string {
@@ -42,11 +127,11 @@ func (e NotExpr) String() string {
 }
 
 func (e AndExpr) String() string {
-	return fmt.Sprint("Not[", e.LHS, " ", e.RHS, "]")
+	return fmt.Sprint("And[", e.LHS, " ", e.RHS, "]")
 }
 
 func (e OrExpr) String() string {
-	return fmt.Sprint("Not[", e.LHS, " ", e.RHS, "]")
+	return fmt.Sprint("Or[", e.LHS, " ", e.RHS, "]")
 }
 
 func (e OpExpr) String() string {
@@ -0,0 +1,103 @@
+package mini
+
+import (
+	"math/big"
+)
+
+// BigInt is an arbitrary precision integer. BigInts are immutable.
+type BigInt struct {
+	val *big.Int
+}
+
+// NewBigInt constructs a BigInt from a copy of v
+func NewBigInt(v *big.Int) BigInt { return BigInt{new(big.Int).Set(v)} }
+
+// NewBigIntFromInt64 constructs a BigInt from an int64
+func NewBigIntFromInt64(v int64) BigInt { return BigInt{big.NewInt(v)} }
+
+// Truthy helps BigInt implement the Object interface
+func (o BigInt) Truthy() bool { return true }
+
+// IsNil helps BigInt implement the Object interface
+func (o BigInt) IsNil() bool { return false }
+
+// Send helps BigInt implement the Object interface. Division by / yields an
+// exact Decimal; use ~/ for integer division.
+func (o BigInt) Send(op Op, args Args) (Object, error) {
+	return o.sendMetered(nil, op, args)
+}
+
+func (o BigInt) sendMetered(m *meter, op Op, args Args) (Object, error) {
+	if ret, ok, err := sendMixed(m, op, o, args.Arg(0)); ok {
+		return ret, err
+	}
+	switch op {
+	case OpNeg:
+		return BigInt{new(big.Int).Neg(o.val)}, nil
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpPow, OpFloorDiv, OpLt, OpLe, OpGt, OpGe, OpEq, OpNe:
+		rhs, ok := args.Arg(0).(BigInt)
+		if !ok {
+			return nil, newErrTypeBadRhs(op, o, args.Arg(0), bigIntType)
+		}
+		switch op {
+		case OpAdd:
+			return o.charged(m, new(big.Int).Add(o.val, rhs.val))
+		case OpSub:
+			return o.charged(m, new(big.Int).Sub(o.val, rhs.val))
+		case OpMul:
+			if err := m.checkBig(o.val.BitLen()+rhs.val.BitLen(), maxBigIntBits); err != nil {
+				return nil, err
+			}
+			return o.charged(m, new(big.Int).Mul(o.val, rhs.val))
+		case OpDiv:
+			return sendWith(m, o.promote(rankDecimal), op, Args{rhs.promote(rankDecimal)})
+		case OpMod, OpFloorDiv:
+			if rhs.val.Sign() == 0 {
+				return nil, ErrZeroDivision
+			}
+			// round the quotient towards negative infinity, as for Int
+			q, r := new(big.Int).QuoRem(o.val, rhs.val, new(big.Int))
+			if r.Sign() != 0 && r.Sign() != rhs.val.Sign() {
+				q.Sub(q, big.NewInt(1))
+				r.Add(r, rhs.val)
+			}
+			if op == OpMod {
+				return BigInt{r}, nil
+			}
+			return BigInt{q}, nil
+		case OpPow:
+			if rhs.val.Sign() < 0 {
+				return sendWith(m, o.promote(rankDecimal), op, Args{rhs.promote(rankDecimal)})
+			}
+			// account for the result before computing it, since it may be
+			// enormous
+			bits := powBitLen(o.val.BitLen(), rhs.val)
+			if err := m.checkBig(bits, maxBigIntBits); err != nil {
+				return nil, err
+			}
+			if err := m.chargeBig(bits); err != nil {
+				return nil, err
+			}
+			return BigInt{new(big.Int).Exp(o.val, rhs.val, nil)}, nil
+		default:
+			return compareResult(op, o.val.Cmp(rhs.val), true), nil
+		}
+	}
+	return nil, NewErrInvalidOp(op, o)
+}
+
+// charged accounts for v with m and returns it as a BigInt
+func (o BigInt) charged(m *meter, v *big.Int) (Object, error) {
+	if err := m.chargeBig(v.BitLen()); err != nil {
+		return nil, err
+	}
+	return BigInt{v}, nil
+}
+
+// Eval helps BigInt implement the Expression interface
+func (o BigInt) Eval(*Vm) (Object, error) { return o, nil }
+
+// ToBigInt returns a copy of the value of o
+func (o BigInt) ToBigInt() *big.Int { return new(big.Int).Set(o.val) }
+
+func (o BigInt) String() string { return o.val.String() }
@@ -26,9 +26,8 @@ func (o Bool) Send(op Op, args Args) (Object, error) {
 		}
 		if op == OpEq {
 			return Bool(o.Truthy() == rhs.Truthy()), nil
-		} else {
-			return Bool(o.Truthy() == rhs.Truthy()), nil
 		}
+		return Bool(o.Truthy() != rhs.Truthy()), nil
 	}
 	return nil, NewErrInvalidOp(op, o)
 }
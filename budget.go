@@ -0,0 +1,96 @@
+package mini
+
+import "fmt"
+
+// DefaultMaxCallDepth is the call depth limit of a new Vm
+const DefaultMaxCallDepth = 1000
+
+// StepLimitError is returned when an evaluation takes more than Vm.MaxSteps
+// steps
+type StepLimitError struct {
+	Limit int64
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("step limit of %d exceeded", e.Limit)
+}
+
+// CallDepthError is returned when function calls nest deeper than
+// Vm.MaxCallDepth
+type CallDepthError struct {
+	Limit int
+}
+
+func (e *CallDepthError) Error() string {
+	return fmt.Sprintf("call depth limit of %d exceeded", e.Limit)
+}
+
+// CanceledError is returned when the context of an evaluation is done before
+// it finishes. Err is the error of the context.
+type CanceledError struct {
+	Err error
+}
+
+func (e *CanceledError) Error() string {
+	return "evaluation canceled: " + e.Err.Error()
+}
+
+// isFatal returns true if err stops the evaluation. Scripts cannot catch
+// fatal errors, and finally blocks do not run for them.
+func isFatal(err error) bool {
+	switch err.(type) {
+	case *StepLimitError, *CallDepthError, *CanceledError:
+		return true
+	}
+	return err == ErrMemoryLimit
+}
+
+// step counts one loop iteration or function call against the budget of the
+// current evaluation
+func (vm *Vm) step() error {
+	vm.steps++
+	if vm.MaxSteps > 0 && vm.steps > vm.MaxSteps {
+		return &StepLimitError{vm.MaxSteps}
+	}
+	if vm.ctx != nil {
+		// a single step may be expensive, so the context is checked on
+		// every one
+		select {
+		case <-vm.ctx.Done():
+			return &CanceledError{vm.ctx.Err()}
+		default:
+		}
+	}
+	return nil
+}
+
+// enterCall counts a function call, which must be matched by leaveCall if it
+// succeeds
+func (vm *Vm) enterCall() error {
+	if vm.MaxCallDepth > 0 && vm.calls >= vm.MaxCallDepth {
+		return &CallDepthError{vm.MaxCallDepth}
+	}
+	if err := vm.step(); err != nil {
+		return err
+	}
+	vm.calls++
+	return nil
+}
+
+func (vm *Vm) leaveCall() {
+	vm.calls--
+}
+
+// callFunction calls fn with args. A Lambda counts its own call, and a call
+// to any other function is counted here, so that native functions are
+// subject to the same budget.
+func (vm *Vm) callFunction(fn Callable, args Args) (Object, error) {
+	if _, ok := fn.(*Lambda); ok {
+		return fn.Call(args)
+	}
+	if err := vm.enterCall(); err != nil {
+		return nil, err
+	}
+	defer vm.leaveCall()
+	return fn.Call(args)
+}
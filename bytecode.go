@@ -0,0 +1,160 @@
+package mini
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// opcode identifies a bytecode instruction. The comment on each opcode
+// describes its operand and its effect on the operand stack.
+type opcode uint8
+
+const (
+	opConst       opcode = iota // a: constant; push it
+	opPop                       // pop one value
+	opTruncate                  // a: count; pop that many values
+	opTruncateTo                // a: count; pop that many values from beneath the top one
+	opLoad                      // a: name ref; push the value bound to it
+	opStore                     // a: name ref; assign the top value to it
+	opDefine                    // a: slot; pop a value and bind it in the current frame
+	opEnter                     // a: slots; push a frame with that many slots
+	opLeave                     // a: count; pop that many frames
+	opJump                      // a: target
+	opJumpIfFalse               // a: target; pop a value and jump if it is falsy
+	opAnd                       // a: target; jump if the top value is falsy, else pop it
+	opOr                        // a: target; jump if the top value is truthy, else pop it
+	opFalsify                   // replace the top value with FALSE if it is falsy
+	opNot                       // replace the top value with its negation
+	opSend                      // a: site; pop the arguments and base and push base.Send(args)
+	opMethod                    // a: site; pop a value and push its bound method
+	opCallable                  // a: site; check that the top value is callable
+	opCall                      // a: site; pop the arguments and function and push the result
+	opList                      // a: count; pop that many items and push a list of them
+	opMap                       // push an empty map
+	opMapSet                    // a: site; pop a key and value and set them in the map beneath
+	opClosure                   // a: function; push a closure over the current frame
+	opReturn                    // pop a value and return it
+	opIter                      // a: site; replace the top value with an iterator over it
+	opIterNext                  // a: target, b: key flag; push the next value and key, or pop and jump
+	opTry                       // a: target, b: count; install a handler dropping count values
+	opEndTry                    // remove the innermost error handler
+	opCatch                     // replace the caught error on top with an Error
+	opRethrow                   // pop a caught error and raise it again
+	opStep                      // count a step against the budget
+)
+
+var opcodeNames = []string{
+	opConst:       "const",
+	opPop:         "pop",
+	opTruncate:    "truncate",
+	opTruncateTo:  "truncateto",
+	opLoad:        "load",
+	opStore:       "store",
+	opDefine:      "define",
+	opEnter:       "enter",
+	opLeave:       "leave",
+	opJump:        "jump",
+	opJumpIfFalse: "jumpiffalse",
+	opAnd:         "and",
+	opOr:          "or",
+	opFalsify:     "falsify",
+	opNot:         "not",
+	opSend:        "send",
+	opMethod:      "method",
+	opCallable:    "callable",
+	opCall:        "call",
+	opList:        "list",
+	opMap:         "map",
+	opMapSet:      "mapset",
+	opClosure:     "closure",
+	opReturn:      "return",
+	opIter:        "iter",
+	opIterNext:    "iternext",
+	opTry:         "try",
+	opEndTry:      "endtry",
+	opCatch:       "catch",
+	opRethrow:     "rethrow",
+	opStep:        "step",
+}
+
+func (op opcode) String() string {
+	if int(op) < len(opcodeNames) {
+		return opcodeNames[op]
+	}
+	return fmt.Sprintf("opcode(%d)", int(op))
+}
+
+// instr is a single instruction
+type instr struct {
+	op   opcode
+	a, b int32
+}
+
+// nameRef describes how to resolve a name. Slots lists the frame slots which
+// may bind it, innermost first; if none of them is bound the name is
+// resolved in the global scope.
+type nameRef struct {
+	name  Symbol
+	slots []slotRef
+}
+
+// slotRef addresses a slot in the frame depth levels above the current one
+type slotRef struct {
+	depth, slot int
+}
+
+// site describes an operation which may fail, for error reporting
+type site struct {
+	op     Op
+	argc   int
+	name   string
+	callee Expression
+	pos    Position
+	span   Span
+}
+
+// funcProto is the compiled form of a function body, or of a whole program
+type funcProto struct {
+	file   string
+	params []Symbol
+	// frameSize is the number of slots in the frame holding the parameters,
+	// or 0 if the function needs no frame
+	frameSize  int
+	paramSlots []int
+	code       []instr
+	consts     []Object
+	refs       []nameRef
+	sites      []site
+	funcs      []*funcProto
+}
+
+// String disassembles f, including the functions it defines
+func (f *funcProto) String() string {
+	var buf bytes.Buffer
+	f.disassemble(&buf, "")
+	return buf.String()
+}
+
+func (f *funcProto) disassemble(buf *bytes.Buffer, indent string) {
+	for pc, in := range f.code {
+		fmt.Fprintf(buf, "%s%4d %-12v", indent, pc, in.op)
+		switch in.op {
+		case opConst:
+			fmt.Fprintf(buf, "%v", f.consts[in.a])
+		case opLoad, opStore:
+			fmt.Fprintf(buf, "%s %v", f.refs[in.a].name, f.refs[in.a].slots)
+		case opSend, opMethod, opCallable, opCall:
+			s := f.sites[in.a]
+			fmt.Fprintf(buf, "%v %s %d", s.op, s.name, s.argc)
+		case opIterNext, opTry:
+			fmt.Fprintf(buf, "%d %d", in.a, in.b)
+		case opDefine, opEnter, opLeave, opJump, opJumpIfFalse, opAnd, opOr,
+			opTruncate, opTruncateTo, opList, opClosure:
+			fmt.Fprintf(buf, "%d", in.a)
+		}
+		buf.WriteByte('\n')
+		if in.op == opClosure {
+			f.funcs[in.a].disassemble(buf, indent+"    ")
+		}
+	}
+}
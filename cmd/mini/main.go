@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/jncornett/mini"
 )
@@ -16,6 +18,8 @@ func main() {
 	var (
 		debug = flag.Bool("debug", false, "turn on debug logging")
 		repl  = flag.Bool("repl", false, "enter REPL mode")
+		tree  = flag.Bool("tree", false, "use the tree-walking interpreter")
+		color = flag.Bool("color", isTerminal(os.Stderr), "color error messages")
 	)
 	flag.Parse()
 	if flag.NArg() == 0 {
@@ -23,34 +27,58 @@ func main() {
 	}
 	vm := mini.NewVm()
 	vm.Debug = *debug
+	if *tree {
+		vm.Backend = mini.TreeBackend
+	}
+	style := mini.StylePlain
+	if *color {
+		style = mini.StyleANSI
+	}
 	for _, script := range flag.Args() {
-		err := runScript(vm, script)
+		src, err := ioutil.ReadFile(script)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if !check(script, string(src), style) {
+			os.Exit(1)
+		}
+		if err := vm.EvalFile(script, strings.NewReader(string(src))); err != nil {
+			mini.RenderError(os.Stderr, err, string(src), style)
+			os.Exit(1)
+		}
 	}
 	if *repl {
-		enterRepl(vm, ":-) ")
+		enterRepl(vm, ":-) ", style)
 	}
 }
 
-func runScript(vm *mini.Vm, p string) error {
-	f, err := os.Open(p)
-	defer f.Close()
-	if err != nil {
-		return err
+// check renders every syntax error in src, and reports whether there were
+// none
+func check(file, src string, style mini.Style) bool {
+	p := mini.NewFileParser(file, strings.NewReader(src))
+	if _, err := p.Parse(); err == nil {
+		return true
 	}
-	return vm.Eval(f)
+	for _, d := range p.Diagnostics() {
+		d.Render(os.Stderr, src, style)
+	}
+	return false
+}
+
+// isTerminal reports whether f looks like a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
 
-func enterRepl(vm *mini.Vm, prompt string) {
+func enterRepl(vm *mini.Vm, prompt string, style mini.Style) {
 	r := bufio.NewReader(os.Stdin)
 	for {
 		fmt.Print(prompt)
 		code, _ := r.ReadString('\n')
 		err := vm.EvalString(code)
 		if err != nil {
-			fmt.Println("error:", err)
+			mini.RenderError(os.Stdout, err, code, style)
 		} else if vm.Result != nil {
 			fmt.Println("=>", vm.Result)
 		}
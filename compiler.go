@@ -0,0 +1,627 @@
+package mini
+
+import "fmt"
+
+// compile translates the program expr into bytecode. The program runs in
+// the global scope, so only the scopes nested in it have frames.
+func compile(expr Expression, file string) (f *funcProto, err error) {
+	c := &compiler{fn: &funcProto{file: file}}
+	defer func() {
+		if r := recover(); r != nil {
+			cerr, ok := r.(compileError)
+			if !ok {
+				panic(r)
+			}
+			f, err = nil, asError(cerr.error)
+		}
+	}()
+	c.compileExpr(expr)
+	c.emit(opReturn, 0, 0)
+	return c.fn, nil
+}
+
+// compileError aborts compilation of an expression the compiler does not
+// support
+type compileError struct {
+	error
+}
+
+// compiler compiles a single function. It tracks the depth of the operand
+// stack and the number of frames entered so far, so that a jump out of a
+// loop or a try block can restore both.
+type compiler struct {
+	fn      *funcProto
+	scope   *compScope
+	depth   int
+	frames  int
+	regions []region
+}
+
+// compScope is a scope which declares names, and so needs a frame. Scopes
+// which declare no names are not represented.
+type compScope struct {
+	names  map[Symbol]int
+	parent *compScope
+}
+
+type regionKind int
+
+const (
+	regionLoop regionKind = iota
+	regionHandler
+	regionFinally
+)
+
+// region is a construct which a break, continue or return may jump out of.
+// It records the stack depth, frame count and scope on entry.
+type region struct {
+	kind   regionKind
+	label  string
+	depth  int
+	frames int
+	scope  *compScope
+	// loops only
+	breaks       []int
+	continuePC   int
+	continueDeep int
+	// finally blocks only
+	finally *Block
+}
+
+func (c *compiler) emit(op opcode, a, b int) int {
+	c.fn.code = append(c.fn.code, instr{op: op, a: int32(a), b: int32(b)})
+	return len(c.fn.code) - 1
+}
+
+// patch points the jump at pc to the next instruction
+func (c *compiler) patch(pc int) {
+	c.fn.code[pc].a = int32(len(c.fn.code))
+}
+
+func (c *compiler) constant(obj Object) {
+	c.fn.consts = append(c.fn.consts, obj)
+	c.emit(opConst, len(c.fn.consts)-1, 0)
+	c.depth++
+}
+
+func (c *compiler) site(s site) int {
+	c.fn.sites = append(c.fn.sites, s)
+	return len(c.fn.sites) - 1
+}
+
+// ref returns a reference to name which lists every enclosing frame slot
+// which may bind it
+func (c *compiler) ref(name Symbol) int {
+	r := nameRef{name: name}
+	depth := 0
+	for s := c.scope; s != nil; s = s.parent {
+		if slot, ok := s.names[name]; ok {
+			r.slots = append(r.slots, slotRef{depth, slot})
+		}
+		depth++
+	}
+	c.fn.refs = append(c.fn.refs, r)
+	return len(c.fn.refs) - 1
+}
+
+func (c *compiler) compileExpr(expr Expression) {
+	switch e := expr.(type) {
+	case *Tree:
+		c.compileSequence(e.Exprs)
+	case *Block:
+		c.compileScoped(nil, e.Exprs)
+	case *IfExpr:
+		c.compileIf(e)
+	case *ForExpr:
+		c.compileFor(e)
+	case *ForInExpr:
+		c.compileForIn(e)
+	case *TryExpr:
+		c.compileTry(e)
+	case *BreakExpr:
+		c.compileLoopControl(e.Label, false)
+	case *ContinueExpr:
+		c.compileLoopControl(e.Label, true)
+	case *ReturnExpr:
+		c.compileReturn(e)
+	case *AssignExpr:
+		c.compileExpr(e.Expr)
+		c.emit(opStore, c.ref(e.Name), 0)
+	case *CallExpr:
+		c.compileCall(e)
+	case *SelectorExpr:
+		c.compileExpr(e.Base)
+		c.emit(opMethod, c.site(site{name: e.Name, pos: e.Pos, span: e.Span}), 0)
+	case *FuncExpr:
+		c.compileFunc(e)
+	case *ListExpr:
+		for _, item := range e.Items {
+			c.compileExpr(item)
+		}
+		c.emit(opList, len(e.Items), 0)
+		c.depth += 1 - len(e.Items)
+	case *MapExpr:
+		c.emit(opMap, 0, 0)
+		c.depth++
+		for i, key := range e.Keys {
+			c.compileExpr(key)
+			c.compileExpr(e.Values[i])
+			c.emit(opMapSet, c.site(site{pos: SpanOf(key).Start, span: SpanOf(key)}), 0)
+			c.depth -= 2
+		}
+	case *Ident:
+		c.emit(opLoad, c.ref(e.Name), 0)
+		c.depth++
+	case *Literal:
+		c.constant(e.Value)
+	case Symbol:
+		c.emit(opLoad, c.ref(e), 0)
+		c.depth++
+	case *NotExpr:
+		c.compileNot(*e)
+	case NotExpr:
+		c.compileNot(e)
+	case *AndExpr:
+		c.compileLogical(opAnd, e.LHS, e.RHS)
+	case AndExpr:
+		c.compileLogical(opAnd, e.LHS, e.RHS)
+	case *OrExpr:
+		c.compileLogical(opOr, e.LHS, e.RHS)
+	case OrExpr:
+		c.compileLogical(opOr, e.LHS, e.RHS)
+	case *OpExpr:
+		c.compileOp(*e)
+	case OpExpr:
+		c.compileOp(e)
+	case Object:
+		c.constant(e)
+	default:
+		panic(compileError{fmt.Errorf("cannot compile %T", expr)})
+	}
+}
+
+// compileSequence compiles exprs, keeping only the value of the last one
+func (c *compiler) compileSequence(exprs []Expression) {
+	if len(exprs) == 0 {
+		c.constant(nil)
+		return
+	}
+	for i, expr := range exprs {
+		if i > 0 {
+			c.emit(opPop, 0, 0)
+			c.depth--
+		}
+		c.compileExpr(expr)
+	}
+}
+
+// compileScoped compiles exprs in a new scope, whose first names are bound to
+// the values on top of the stack. The scope needs a frame only if it
+// declares any names.
+func (c *compiler) compileScoped(bound []Symbol, exprs []Expression) {
+	names := append(append([]Symbol(nil), bound...), declaredNames(exprs)...)
+	if len(names) == 0 {
+		c.compileSequence(exprs)
+		return
+	}
+	scope := &compScope{names: make(map[Symbol]int), parent: c.scope}
+	for _, name := range names {
+		if _, ok := scope.names[name]; !ok {
+			scope.names[name] = len(scope.names)
+		}
+	}
+	c.emit(opEnter, len(scope.names), 0)
+	c.frames++
+	c.scope = scope
+	// the last value bound is on top of the stack
+	for i := len(bound) - 1; i >= 0; i-- {
+		c.emit(opDefine, scope.names[bound[i]], 0)
+		c.depth--
+	}
+	c.compileSequence(exprs)
+	c.scope = scope.parent
+	c.emit(opLeave, 1, 0)
+	c.frames--
+}
+
+func (c *compiler) compileIf(e *IfExpr) {
+	if e.If.Condition == nil {
+		c.compileElse(e.Else)
+		return
+	}
+	c.compileExpr(e.If.Condition)
+	if e.If.Block == nil {
+		// a branch without a block is never taken
+		c.emit(opPop, 0, 0)
+		c.depth--
+		c.compileElse(e.Else)
+		return
+	}
+	skip := c.emit(opJumpIfFalse, 0, 0)
+	c.depth--
+	c.compileExpr(e.If.Block)
+	end := c.emit(opJump, 0, 0)
+	c.depth--
+	c.patch(skip)
+	c.compileElse(e.Else)
+	c.patch(end)
+}
+
+func (c *compiler) compileElse(cb ConditionalBlock) {
+	if cb.Condition == nil || cb.Block == nil {
+		if cb.Condition != nil {
+			c.compileExpr(cb.Condition)
+			c.emit(opPop, 0, 0)
+			c.depth--
+		}
+		c.constant(NIL)
+		return
+	}
+	c.compileExpr(cb.Condition)
+	skip := c.emit(opJumpIfFalse, 0, 0)
+	c.depth--
+	c.compileExpr(cb.Block)
+	end := c.emit(opJump, 0, 0)
+	c.depth--
+	c.patch(skip)
+	c.constant(NIL)
+	c.patch(end)
+}
+
+func (c *compiler) compileFor(e *ForExpr) {
+	if e.For.Condition == nil {
+		// a loop without a condition never runs
+		c.constant(NIL)
+		return
+	}
+	start := c.emit(opStep, 0, 0)
+	c.regions = append(c.regions, region{
+		kind:         regionLoop,
+		label:        e.Label,
+		depth:        c.depth,
+		frames:       c.frames,
+		continuePC:   start,
+		continueDeep: c.depth,
+	})
+	c.compileExpr(e.For.Condition)
+	exit := c.emit(opJumpIfFalse, 0, 0)
+	c.depth--
+	if e.For.Block != nil {
+		c.compileExpr(e.For.Block)
+		c.emit(opPop, 0, 0)
+		c.depth--
+		c.emit(opJump, start, 0)
+	}
+	c.patch(exit)
+	c.endLoop()
+}
+
+// endLoop pops the innermost loop region and pushes the value of the loop,
+// which is where any break jumps to
+func (c *compiler) endLoop() {
+	r := c.regions[len(c.regions)-1]
+	c.regions = c.regions[:len(c.regions)-1]
+	for _, pc := range r.breaks {
+		c.patch(pc)
+	}
+	c.constant(NIL)
+}
+
+func (c *compiler) compileForIn(e *ForInExpr) {
+	c.compileExpr(e.Iter)
+	c.emit(opIter, c.site(site{pos: SpanOf(e.Iter).Start, span: SpanOf(e.Iter)}), 0)
+	start := c.emit(opIterNext, 0, 0)
+	bound := []Symbol{e.Value}
+	if e.Key != "" {
+		c.fn.code[start].b = 1
+		bound = []Symbol{e.Value, e.Key}
+		c.depth++
+	}
+	c.depth++
+	c.emit(opStep, 0, 0)
+	c.regions = append(c.regions, region{
+		kind:         regionLoop,
+		label:        e.Label,
+		depth:        c.depth - len(bound) - 1,
+		frames:       c.frames,
+		continuePC:   start,
+		continueDeep: c.depth - len(bound),
+	})
+	c.compileScoped(bound, e.Body.Exprs)
+	c.emit(opPop, 0, 0)
+	c.depth--
+	c.emit(opJump, start, 0)
+	// the iterator is popped when it is exhausted
+	c.patch(start)
+	c.depth--
+	c.endLoop()
+}
+
+// compileTry compiles a try expression. The body runs under a handler which
+// jumps to the catch block, or straight to the finally block if there is no
+// catch block. The finally block is compiled once for each way of leaving
+// the try expression.
+func (c *compiler) compileTry(e *TryExpr) {
+	if e.Catch == nil && e.Finally == nil {
+		c.compileExpr(e.Body)
+		return
+	}
+	depth := c.depth
+	if e.Finally != nil {
+		c.regions = append(c.regions, region{
+			kind:    regionFinally,
+			depth:   depth,
+			frames:  c.frames,
+			scope:   c.scope,
+			finally: e.Finally,
+		})
+	}
+	handler := c.emit(opTry, 0, 0)
+	c.regions = append(c.regions, region{kind: regionHandler})
+	c.compileExpr(e.Body)
+	c.regions = c.regions[:len(c.regions)-1]
+	c.emit(opEndTry, 0, 0)
+	var done []int
+	if e.Catch != nil {
+		done = append(done, c.emit(opJump, 0, 0))
+		c.patch(handler)
+		c.depth = depth + 1
+		if e.Finally != nil {
+			// the handler discards the error being handled
+			handler = c.emit(opTry, 0, 1)
+			c.regions = append(c.regions, region{kind: regionHandler})
+		}
+		c.emit(opCatch, 0, 0)
+		if e.Name != "" {
+			c.compileScoped([]Symbol{e.Name}, e.Catch.Exprs)
+		} else {
+			c.emit(opPop, 0, 0)
+			c.depth--
+			c.compileScoped(nil, e.Catch.Exprs)
+		}
+		if e.Finally != nil {
+			c.regions = c.regions[:len(c.regions)-1]
+			c.emit(opEndTry, 0, 0)
+		}
+	}
+	if e.Finally != nil {
+		c.regions = c.regions[:len(c.regions)-1]
+		for _, pc := range done {
+			c.patch(pc)
+		}
+		c.compileExpr(e.Finally)
+		c.emit(opPop, 0, 0)
+		c.depth--
+		done = []int{c.emit(opJump, 0, 0)}
+		// a caught error is on the stack until it is raised again
+		c.patch(handler)
+		c.depth = depth + 1
+		c.compileExpr(e.Finally)
+		c.emit(opPop, 0, 0)
+		c.depth--
+		c.emit(opRethrow, 0, 0)
+	}
+	for _, pc := range done {
+		c.patch(pc)
+	}
+	c.depth = depth + 1
+}
+
+func (c *compiler) compileLoopControl(label string, cont bool) {
+	depth, frames, scope := c.depth, c.frames, c.scope
+	target := -1
+	for i := len(c.regions) - 1; i >= 0; i-- {
+		r := c.regions[i]
+		if r.kind == regionLoop && (label == "" || r.label == label) {
+			target = i
+			break
+		}
+	}
+	if target < 0 {
+		panic(compileError{fmt.Errorf("break or continue outside of a loop")})
+	}
+	c.unwindRegions(target, false)
+	r := &c.regions[target]
+	if cont {
+		c.unwindTo(r.continueDeep, r.frames, false)
+		c.emit(opJump, r.continuePC, 0)
+	} else {
+		c.unwindTo(r.depth, r.frames, false)
+		r.breaks = append(r.breaks, c.emit(opJump, 0, 0))
+	}
+	// code after the jump is unreachable, but expects the value of the
+	// break or continue expression
+	c.depth, c.frames, c.scope = depth+1, frames, scope
+}
+
+func (c *compiler) compileReturn(e *ReturnExpr) {
+	if e.Expr == nil {
+		c.constant(NIL)
+	} else {
+		c.compileExpr(e.Expr)
+	}
+	depth, frames, scope := c.depth, c.frames, c.scope
+	c.unwindRegions(-1, true)
+	c.emit(opReturn, 0, 0)
+	c.depth, c.frames, c.scope = depth, frames, scope
+}
+
+// unwindRegions emits the code to leave every region nested inside the one
+// at index until: handlers are removed and finally blocks run. If keep is
+// set the value on top of the stack is preserved.
+func (c *compiler) unwindRegions(until int, keep bool) {
+	for i := len(c.regions) - 1; i > until; i-- {
+		r := c.regions[i]
+		switch r.kind {
+		case regionHandler:
+			c.emit(opEndTry, 0, 0)
+		case regionFinally:
+			c.unwindTo(r.depth, r.frames, keep)
+			regions, scope := c.regions, c.scope
+			c.regions, c.scope = c.regions[:i], r.scope
+			c.compileExpr(r.finally)
+			c.emit(opPop, 0, 0)
+			c.depth--
+			c.regions, c.scope = regions, scope
+		}
+	}
+}
+
+// unwindTo emits the code to pop values and frames down to the given depth
+// and frame count. If keep is set the value on top of the stack is kept.
+func (c *compiler) unwindTo(depth, frames int, keep bool) {
+	if keep {
+		if n := c.depth - 1 - depth; n > 0 {
+			c.emit(opTruncateTo, n, 0)
+			c.depth -= n
+		}
+	} else if n := c.depth - depth; n > 0 {
+		c.emit(opTruncate, n, 0)
+		c.depth -= n
+	}
+	if n := c.frames - frames; n > 0 {
+		c.emit(opLeave, n, 0)
+		c.frames = frames
+	}
+}
+
+func (c *compiler) compileCall(e *CallExpr) {
+	c.compileExpr(e.Func)
+	c.emit(opCallable, c.site(site{callee: e.Func, pos: e.Pos, span: e.Span}), 0)
+	for _, arg := range e.Args {
+		c.compileExpr(arg)
+	}
+	c.emit(opCall, c.site(site{argc: len(e.Args), callee: e.Func, pos: e.Pos, span: e.Span}), 0)
+	c.depth -= len(e.Args)
+}
+
+func (c *compiler) compileFunc(e *FuncExpr) {
+	fc := &compiler{fn: &funcProto{params: e.Params, file: c.fn.file}, scope: c.scope}
+	names := append(append([]Symbol(nil), e.Params...), declaredNames(e.Body.Exprs)...)
+	if len(names) > 0 {
+		fc.scope = &compScope{names: make(map[Symbol]int), parent: c.scope}
+		for _, name := range names {
+			if _, ok := fc.scope.names[name]; !ok {
+				fc.scope.names[name] = len(fc.scope.names)
+			}
+		}
+		fc.fn.frameSize = len(fc.scope.names)
+		for _, param := range e.Params {
+			fc.fn.paramSlots = append(fc.fn.paramSlots, fc.scope.names[param])
+		}
+	}
+	fc.compileSequence(e.Body.Exprs)
+	fc.emit(opReturn, 0, 0)
+	c.fn.funcs = append(c.fn.funcs, fc.fn)
+	c.emit(opClosure, len(c.fn.funcs)-1, 0)
+	c.depth++
+}
+
+func (c *compiler) compileNot(e NotExpr) {
+	if e.Expr == nil {
+		c.constant(NIL)
+		return
+	}
+	c.compileExpr(e.Expr)
+	c.emit(opNot, 0, 0)
+}
+
+// compileLogical compiles and or or. Either evaluates to its left operand if
+// that decides the result, else to its right operand if truthy, else FALSE.
+func (c *compiler) compileLogical(op opcode, lhs, rhs Expression) {
+	if lhs == nil || rhs == nil {
+		c.constant(NIL)
+		return
+	}
+	c.compileExpr(lhs)
+	skip := c.emit(op, 0, 0)
+	c.depth--
+	c.compileExpr(rhs)
+	c.emit(opFalsify, 0, 0)
+	c.patch(skip)
+}
+
+func (c *compiler) compileOp(e OpExpr) {
+	c.compileExpr(e.Base)
+	for _, arg := range e.Args {
+		c.compileExpr(arg)
+	}
+	c.emit(opSend, c.site(site{op: e.Op, argc: len(e.Args), pos: e.Pos, span: e.Span}), 0)
+	c.depth -= len(e.Args)
+}
+
+// declaredNames returns the names assigned directly in the scope of exprs,
+// that is outside of any nested block or function
+func declaredNames(exprs []Expression) []Symbol {
+	var names []Symbol
+	var walk func(Expression)
+	walk = func(expr Expression) {
+		switch e := expr.(type) {
+		case *Tree:
+			for _, child := range e.Exprs {
+				walk(child)
+			}
+		case *IfExpr:
+			walk(e.If.Condition)
+			walk(e.If.Block)
+			walk(e.Else.Condition)
+			walk(e.Else.Block)
+		case *ForExpr:
+			walk(e.For.Condition)
+			walk(e.For.Block)
+		case *ForInExpr:
+			walk(e.Iter)
+		case *AssignExpr:
+			names = append(names, e.Name)
+			walk(e.Expr)
+		case *CallExpr:
+			walk(e.Func)
+			for _, arg := range e.Args {
+				walk(arg)
+			}
+		case *SelectorExpr:
+			walk(e.Base)
+		case *ReturnExpr:
+			walk(e.Expr)
+		case *ListExpr:
+			for _, item := range e.Items {
+				walk(item)
+			}
+		case *MapExpr:
+			for i, key := range e.Keys {
+				walk(key)
+				walk(e.Values[i])
+			}
+		case *NotExpr:
+			walk(e.Expr)
+		case NotExpr:
+			walk(e.Expr)
+		case *AndExpr:
+			walk(e.LHS)
+			walk(e.RHS)
+		case AndExpr:
+			walk(e.LHS)
+			walk(e.RHS)
+		case *OrExpr:
+			walk(e.LHS)
+			walk(e.RHS)
+		case OrExpr:
+			walk(e.LHS)
+			walk(e.RHS)
+		case *OpExpr:
+			walk(e.Base)
+			for _, arg := range e.Args {
+				walk(arg)
+			}
+		case OpExpr:
+			walk(e.Base)
+			for _, arg := range e.Args {
+				walk(arg)
+			}
+		}
+	}
+	for _, expr := range exprs {
+		walk(expr)
+	}
+	return names
+}
@@ -0,0 +1,49 @@
+package mini
+
+// controlKind identifies a pending non-local exit
+type controlKind int
+
+const (
+	controlNone controlKind = iota
+	controlBreak
+	controlContinue
+	controlReturn
+)
+
+// control is a non-local exit. While one is pending, enclosing expressions
+// stop evaluating until the construct it targets handles it.
+type control struct {
+	kind  controlKind
+	label string
+	value Object
+}
+
+// unwinding returns true if a non-local exit is pending
+func (vm *Vm) unwinding() bool {
+	return vm.control.kind != controlNone
+}
+
+// catchLoopControl handles a pending break or continue which targets the loop
+// labelled label. It reports whether the loop should stop.
+func (vm *Vm) catchLoopControl(label string) (stop bool) {
+	c := vm.control
+	switch c.kind {
+	case controlNone:
+		return false
+	case controlBreak, controlContinue:
+		if c.label == "" || c.label == label {
+			vm.control = control{}
+			return c.kind == controlBreak
+		}
+	}
+	return true
+}
+
+// catchReturn handles a pending return, yielding its value in place of obj
+func (vm *Vm) catchReturn(obj Object) Object {
+	if vm.control.kind == controlReturn {
+		obj = vm.control.value
+		vm.control = control{}
+	}
+	return obj
+}
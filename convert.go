@@ -0,0 +1,94 @@
+package mini
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// convertInt converts a number or string to an Int, truncating any fraction
+func convertInt(args Args) (Object, error) {
+	if s, ok := args.Arg(0).(String); ok {
+		val, err := strconv.ParseInt(string(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ValueError: invalid int %q", string(s))
+		}
+		return Int(val), nil
+	}
+	n, err := truncateArg(args.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	if !n.IsInt64() {
+		return nil, ErrOverflow
+	}
+	return Int(n.Int64()), nil
+}
+
+// convertBigInt converts a number or string to a BigInt, truncating any
+// fraction
+func convertBigInt(args Args) (Object, error) {
+	if s, ok := args.Arg(0).(String); ok {
+		val, ok := new(big.Int).SetString(string(s), 10)
+		if !ok {
+			return nil, fmt.Errorf("ValueError: invalid bigint %q", string(s))
+		}
+		return BigInt{val}, nil
+	}
+	n, err := truncateArg(args.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	return BigInt{n}, nil
+}
+
+// convertDecimal converts a number or string to a Decimal. A Number converts
+// to the shortest decimal which reads back as the same Number, so that
+// decimal(0.1) == 0.1d.
+func convertDecimal(args Args) (Object, error) {
+	var s string
+	switch arg := args.Arg(0).(type) {
+	case String:
+		s = string(arg)
+	case Number:
+		s = strconv.FormatFloat(float64(arg), 'g', -1, 64)
+	case numeric:
+		return arg.promote(rankDecimal), nil
+	default:
+		return nil, newTypeError(0, decimalType, arg)
+	}
+	val, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("ValueError: invalid decimal %q", s)
+	}
+	return Decimal{val}, nil
+}
+
+// convertFloat converts a number or string to a Number
+func convertFloat(args Args) (Object, error) {
+	switch arg := args.Arg(0).(type) {
+	case String:
+		val, err := strconv.ParseFloat(string(arg), 64)
+		if err != nil {
+			return nil, fmt.Errorf("ValueError: invalid float %q", string(arg))
+		}
+		return Number(val), nil
+	case numeric:
+		return arg.promote(rankNumber), nil
+	default:
+		return nil, newTypeError(0, numberType, arg)
+	}
+}
+
+// truncateArg returns the integral part of the number obj
+func truncateArg(obj Object) (*big.Int, error) {
+	n, ok := obj.(numeric)
+	if !ok {
+		return nil, fmt.Errorf("TypeError: expected argument 0 to be a number, got %T", obj)
+	}
+	r := n.toRat()
+	if r == nil {
+		return nil, fmt.Errorf("ValueError: cannot convert %v to an integer", obj)
+	}
+	return new(big.Int).Quo(r.Num(), r.Denom()), nil
+}
@@ -0,0 +1,209 @@
+package mini
+
+import (
+	"errors"
+	"math/big"
+)
+
+// decimalMaxScale is the number of decimal places to which a Decimal whose
+// decimal expansion does not terminate is printed
+const decimalMaxScale = 28
+
+// Decimal is an exact fractional number, suitable for money. Decimals are
+// immutable.
+type Decimal struct {
+	val *big.Rat
+}
+
+// NewDecimal constructs a Decimal from a copy of v
+func NewDecimal(v *big.Rat) Decimal { return Decimal{new(big.Rat).Set(v)} }
+
+// NewDecimalFromString constructs a Decimal from a decimal string such as
+// "12.50"
+func NewDecimalFromString(s string) (Decimal, error) {
+	v, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, errors.New("invalid decimal " + s)
+	}
+	return Decimal{v}, nil
+}
+
+// Truthy helps Decimal implement the Object interface
+func (o Decimal) Truthy() bool { return true }
+
+// IsNil helps Decimal implement the Object interface
+func (o Decimal) IsNil() bool { return false }
+
+// Send helps Decimal implement the Object interface
+func (o Decimal) Send(op Op, args Args) (Object, error) {
+	return o.sendMetered(nil, op, args)
+}
+
+func (o Decimal) sendMetered(m *meter, op Op, args Args) (Object, error) {
+	if ret, ok, err := sendMixed(m, op, o, args.Arg(0)); ok {
+		return ret, err
+	}
+	switch op {
+	case OpNeg:
+		return Decimal{new(big.Rat).Neg(o.val)}, nil
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpPow, OpFloorDiv, OpLt, OpLe, OpGt, OpGe, OpEq, OpNe:
+		rhs, ok := args.Arg(0).(Decimal)
+		if !ok {
+			return nil, newErrTypeBadRhs(op, o, args.Arg(0), decimalType)
+		}
+		switch op {
+		case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpFloorDiv:
+			// the terms of the result before it is reduced are no longer
+			// than the operands together
+			if err := m.checkBig(ratBitLen(o.val)+ratBitLen(rhs.val), maxDecimalBits); err != nil {
+				return nil, err
+			}
+		}
+		switch op {
+		case OpAdd:
+			return o.charged(m, new(big.Rat).Add(o.val, rhs.val))
+		case OpSub:
+			return o.charged(m, new(big.Rat).Sub(o.val, rhs.val))
+		case OpMul:
+			return o.charged(m, new(big.Rat).Mul(o.val, rhs.val))
+		case OpDiv:
+			if rhs.val.Sign() == 0 {
+				return nil, ErrZeroDivision
+			}
+			return o.charged(m, new(big.Rat).Quo(o.val, rhs.val))
+		case OpMod, OpFloorDiv:
+			if rhs.val.Sign() == 0 {
+				return nil, ErrZeroDivision
+			}
+			q := floorRat(new(big.Rat).Quo(o.val, rhs.val))
+			if op == OpFloorDiv {
+				return o.charged(m, q)
+			}
+			// the result takes the sign of the divisor, as for Number
+			return o.charged(m, q.Sub(o.val, q.Mul(q, rhs.val)))
+		case OpPow:
+			if !rhs.val.IsInt() {
+				return nil, errors.New("TypeError: Decimal exponents must be integral")
+			}
+			// account for the result before computing it, since it may be
+			// enormous
+			e := new(big.Int).Abs(rhs.val.Num())
+			bits := powBitLen(o.val.Num().BitLen(), e)
+			if d := powBitLen(o.val.Denom().BitLen(), e); d > maxInt-bits {
+				bits = maxInt
+			} else {
+				bits += d
+			}
+			if err := m.checkBig(bits, maxDecimalBits); err != nil {
+				return nil, err
+			}
+			if err := m.chargeBig(bits); err != nil {
+				return nil, err
+			}
+			return powRat(o.val, rhs.val.Num())
+		default:
+			return compareResult(op, o.val.Cmp(rhs.val), true), nil
+		}
+	}
+	return nil, NewErrInvalidOp(op, o)
+}
+
+// charged accounts for v with m and returns it as a Decimal
+func (o Decimal) charged(m *meter, v *big.Rat) (Object, error) {
+	if err := m.chargeBig(ratBitLen(v)); err != nil {
+		return nil, err
+	}
+	return Decimal{v}, nil
+}
+
+// Eval helps Decimal implement the Expression interface
+func (o Decimal) Eval(*Vm) (Object, error) { return o, nil }
+
+// ToRat returns a copy of the value of o
+func (o Decimal) ToRat() *big.Rat { return new(big.Rat).Set(o.val) }
+
+// Round returns o rounded to the given number of decimal places. Halves are
+// rounded to the nearest even digit. Negative places round to the left of
+// the decimal point, so 123d.Round(-1) is 120.
+func (o Decimal) Round(places int) Decimal {
+	e := big.NewInt(int64(places))
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), e.Abs(e), nil))
+	if places < 0 {
+		scale.Inv(scale)
+	}
+	x := new(big.Rat).Mul(o.val, scale)
+	q, r := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	// compare twice the remainder with the denominator to find the nearest
+	// integer to x
+	r.Abs(r).Lsh(r, 1)
+	if c := r.Cmp(x.Denom()); c > 0 || c == 0 && q.Bit(0) == 1 {
+		if x.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Decimal{new(big.Rat).Quo(new(big.Rat).SetInt(q), scale)}
+}
+
+func (o Decimal) String() string {
+	scale, exact := decimalScale(o.val)
+	if !exact || scale > decimalMaxScale {
+		scale = decimalMaxScale
+	}
+	return o.val.FloatString(scale)
+}
+
+// decimalScale returns the number of digits needed after the decimal point
+// to write x exactly, and whether it can be written exactly at all
+func decimalScale(x *big.Rat) (int, bool) {
+	// a fraction has a terminating decimal expansion if its denominator
+	// has no prime factors other than 2 and 5
+	d := new(big.Int).Set(x.Denom())
+	scale := 0
+	for _, p := range []int64{2, 5} {
+		n := 0
+		for m := new(big.Int); ; n++ {
+			q, r := new(big.Int).QuoRem(d, big.NewInt(p), m)
+			if r.Sign() != 0 {
+				break
+			}
+			d = q
+		}
+		if n > scale {
+			scale = n
+		}
+	}
+	return scale, d.Cmp(big.NewInt(1)) == 0
+}
+
+// floorRat returns the largest integer no greater than x
+func floorRat(x *big.Rat) *big.Rat {
+	q, r := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	if r.Sign() < 0 {
+		q.Sub(q, big.NewInt(1))
+	}
+	return new(big.Rat).SetInt(q)
+}
+
+// powRat raises x to the integral power n by repeated squaring
+func powRat(x *big.Rat, n *big.Int) (Object, error) {
+	if x.Sign() == 0 && n.Sign() < 0 {
+		return nil, ErrZeroDivision
+	}
+	base := new(big.Rat).Set(x)
+	if n.Sign() < 0 {
+		base.Inv(base)
+	}
+	e := new(big.Int).Abs(n)
+	result := big.NewRat(1, 1)
+	for i := 0; i < e.BitLen(); i++ {
+		if e.Bit(i) == 1 {
+			result.Mul(result, base)
+		}
+		if i+1 < e.BitLen() {
+			base.Mul(base, base)
+		}
+	}
+	return Decimal{result}, nil
+}
@@ -0,0 +1,190 @@
+package mini
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic describes a problem at a location in a source file, in a form
+// which can be rendered for people to read
+type Diagnostic struct {
+	Kind ErrorKind
+	Msg  string
+	File string
+	// Pos is where the problem is, and Span the extent of the expression or
+	// token at fault, which may be empty
+	Pos  Position
+	Span Span
+	// Hint suggests how to fix the problem, if there is a likely fix
+	Hint string
+	// Trace lists the calls in progress, innermost first
+	Trace []Frame
+}
+
+// Diagnostic describes e, which must have a position
+func (e *Error) Diagnostic() Diagnostic {
+	return Diagnostic{Kind: e.Kind, Msg: e.Msg, File: e.File, Pos: e.Pos, Span: e.Span, Hint: e.Hint, Trace: e.Trace}
+}
+
+// String formats d on one line, as in "file.mini:2:7: TypeError: ..."
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.location(), d.title())
+}
+
+// location formats the file and position of d
+func (d Diagnostic) location() string {
+	if d.File == "" {
+		return d.Pos.String()
+	}
+	return d.File + ":" + d.Pos.String()
+}
+
+// title returns the message of d prefixed by its kind, unless the message
+// already names it
+func (d Diagnostic) title() string {
+	kind := d.Kind.String()
+	if strings.HasPrefix(d.Msg, kind+":") {
+		return d.Msg
+	}
+	return kind + ": " + d.Msg
+}
+
+// Style selects how diagnostics are rendered
+type Style int
+
+const (
+	// StylePlain renders plain text
+	StylePlain Style = iota
+	// StyleANSI renders text colored with ANSI escape sequences
+	StyleANSI
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiError = "\x1b[1;31m"
+	ansiFrame = "\x1b[1;34m"
+	ansiHint  = "\x1b[1;36m"
+)
+
+// paint wraps s in the ANSI color code if the style is StyleANSI
+func (style Style) paint(code, s string) string {
+	if style != StyleANSI || s == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// Render writes d to w with the line of src it refers to, underlining the
+// span at fault, followed by the hint and the stack trace:
+//
+//	TypeError: lenght is not a function
+//	  --> rules.mini:2:13
+//	   |
+//	 2 |   y = lenght(x)
+//	   |       ~~~~~~^~~
+//	   = hint: lenght is not defined
+//	   = in f, called at rules.mini:4:2
+func (d Diagnostic) Render(w io.Writer, src string, style Style) error {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, d.styledTitle(style))
+	line, ok := sourceLine(src, d.Pos.Row)
+	if !ok {
+		fmt.Fprintln(&buf, style.paint(ansiFrame, "  -->"), d.location())
+		d.renderNotes(&buf, "  ", style)
+		_, err := w.Write(buf.Bytes())
+		return err
+	}
+	num := strconv.Itoa(d.Pos.Row + 1)
+	gutter := strings.Repeat(" ", len(num)+2)
+	fmt.Fprintln(&buf, gutter[1:]+style.paint(ansiFrame, "-->"), d.location())
+	fmt.Fprintln(&buf, gutter+style.paint(ansiFrame, "|"))
+	fmt.Fprintln(&buf, style.paint(ansiFrame, " "+num+" |"), line)
+	fmt.Fprintln(&buf, gutter+style.paint(ansiFrame, "|"), d.underline(line, style))
+	d.renderNotes(&buf, gutter, style)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// styledTitle returns the title of d with its kind colored as an error
+func (d Diagnostic) styledTitle(style Style) string {
+	kind := d.Kind.String()
+	return style.paint(ansiError, kind) + style.paint(ansiBold, d.title()[len(kind):])
+}
+
+// renderNotes writes the hint and stack trace of d below its excerpt
+func (d Diagnostic) renderNotes(buf *bytes.Buffer, gutter string, style Style) {
+	if d.Hint != "" {
+		fmt.Fprintln(buf, gutter+style.paint(ansiHint, "= hint:"), d.Hint)
+	}
+	for _, f := range d.Trace {
+		fmt.Fprintln(buf, gutter+style.paint(ansiFrame, "="), f)
+	}
+}
+
+// underline returns the marker line beneath line: a caret at the position of
+// d and tildes under the rest of its span on the same line. Tabs in the
+// indentation are kept so that the markers line up.
+func (d Diagnostic) underline(line string, style Style) string {
+	runes := []rune(line)
+	row, col := d.Pos.Row, d.Pos.Col
+	lo, hi := col, col+1
+	if d.Span != (Span{}) {
+		if d.Span.Start.Row == row {
+			lo = d.Span.Start.Col
+		} else if d.Span.Start.Row < row {
+			lo = 0
+		}
+		if d.Span.End.Row == row {
+			hi = d.Span.End.Col
+		} else if d.Span.End.Row > row {
+			hi = len(runes)
+		}
+	}
+	if lo > col || hi <= col {
+		lo, hi = col, col+1
+	}
+	var pad, marks bytes.Buffer
+	for i := 0; i < lo; i++ {
+		if i < len(runes) && runes[i] == '\t' {
+			pad.WriteByte('\t')
+		} else {
+			pad.WriteByte(' ')
+		}
+	}
+	for i := lo; i < hi; i++ {
+		if i == col {
+			marks.WriteByte('^')
+		} else {
+			marks.WriteByte('~')
+		}
+	}
+	return pad.String() + style.paint(ansiError, marks.String())
+}
+
+// sourceLine returns the line of src with the given index, counting from 0
+func sourceLine(src string, row int) (string, bool) {
+	lines := strings.Split(src, "\n")
+	if row < 0 || row >= len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[row], "\r"), true
+}
+
+// RenderError writes err to w, as a Diagnostic with an excerpt of src if it
+// is an *Error with a position, where src is the source it refers to
+func RenderError(w io.Writer, err error, src string, style Style) error {
+	if e, ok := err.(*Error); ok {
+		if e.HasPos {
+			return e.Diagnostic().Render(w, src, style)
+		}
+		d := Diagnostic{Kind: e.Kind, Msg: e.Msg}
+		_, werr := fmt.Fprintln(w, d.styledTitle(style))
+		return werr
+	}
+	_, werr := fmt.Fprintln(w, style.paint(ansiError, "error")+style.paint(ansiBold, ": "+err.Error()))
+	return werr
+}
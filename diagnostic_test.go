@@ -0,0 +1,152 @@
+package mini_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jncornett/mini"
+)
+
+func TestRenderError(t *testing.T) {
+	tests := []struct {
+		Program  string
+		Expected string
+	}{
+		{
+			"x = 1\ny = x + \"a\"",
+			"TypeError: expected rhs of mini.Int add mini.String to be mini.Int\n" +
+				"  --> rules.mini:2:7\n" +
+				"   |\n" +
+				" 2 | y = x + \"a\"\n" +
+				"   |     ~~^~~~~\n",
+		},
+		{
+			"if x = 1 { }",
+			"SyntaxError: Unexpected assignment in condition\n" +
+				"  --> rules.mini:1:6\n" +
+				"   |\n" +
+				" 1 | if x = 1 { }\n" +
+				"   |      ^\n" +
+				"   = hint: did you mean ==?\n",
+		},
+		{
+			"{1 2}",
+			"SyntaxError: Expected :\n" +
+				"  --> rules.mini:1:4\n" +
+				"   |\n" +
+				" 1 | {1 2}\n" +
+				"   |    ^\n" +
+				"   = hint: map entries are written key: value\n",
+		},
+		{
+			"f(1, 2",
+			"SyntaxError: Unexpected end of input\n" +
+				"  --> rules.mini:1:7\n" +
+				"   |\n" +
+				" 1 | f(1, 2\n" +
+				"   |       ^\n" +
+				"   = hint: is a closing ) missing?\n",
+		},
+		{
+			"undefined(1)",
+			"TypeError: undefined is not a function\n" +
+				"  --> rules.mini:1:10\n" +
+				"   |\n" +
+				" 1 | undefined(1)\n" +
+				"   | ~~~~~~~~~^~~\n" +
+				"   = hint: undefined is not defined\n",
+		},
+		{
+			"\txs = [1]\n\txs[5]",
+			"IndexError: index 5 out of range for length 1\n" +
+				"  --> rules.mini:2:4\n" +
+				"   |\n" +
+				" 2 | \txs[5]\n" +
+				"   | \t~~^~~\n",
+		},
+		{
+			"f = func() {\n  1 / 0\n}\nf()",
+			"ZeroDivisionError: Divide by zero\n" +
+				"  --> rules.mini:2:5\n" +
+				"   |\n" +
+				" 2 |   1 / 0\n" +
+				"   |   ~~^~~\n" +
+				"   = in f, called at rules.mini:4:2\n",
+		},
+		{
+			"12q",
+			"SyntaxError: Unknown number suffix \"q\"\n" +
+				"  --> rules.mini:1:1\n" +
+				"   |\n" +
+				" 1 | 12q\n" +
+				"   | ^~~\n" +
+				"   = hint: use n for a BigInt or d for a Decimal\n",
+		},
+	}
+	for _, backend := range backends {
+		for _, test := range tests {
+			t.Run(backend.Name+"/"+test.Program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				err := vm.EvalFile("rules.mini", strings.NewReader(test.Program))
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				var buf bytes.Buffer
+				if err := mini.RenderError(&buf, err, test.Program, mini.StylePlain); err != nil {
+					t.Fatal(err)
+				}
+				if buf.String() != test.Expected {
+					t.Errorf("expected\n%s\ngot\n%s", test.Expected, buf.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRenderErrorStyle(t *testing.T) {
+	src := "1 + nil"
+	err := mini.NewVm().EvalString(src)
+	var plain, ansi bytes.Buffer
+	mini.RenderError(&plain, err, src, mini.StylePlain)
+	mini.RenderError(&ansi, err, src, mini.StyleANSI)
+	if strings.Contains(plain.String(), "\x1b[") {
+		t.Errorf("expected no escape sequences in plain output, got %q", plain.String())
+	}
+	if !strings.Contains(ansi.String(), "\x1b[") {
+		t.Errorf("expected escape sequences in ANSI output, got %q", ansi.String())
+	}
+}
+
+func TestRenderErrorWithoutPosition(t *testing.T) {
+	tests := []struct {
+		Err      error
+		Expected string
+	}{
+		{errors.New("boom"), "error: boom\n"},
+		{&mini.Error{Kind: mini.ErrorUser, Msg: "boom"}, "UserError: boom\n"},
+		{&mini.Error{Kind: mini.ErrorType, Msg: "bad", HasPos: true, Pos: mini.Position{Row: 9}}, "TypeError: bad\n  --> 10:1\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.Expected, func(t *testing.T) {
+			var buf bytes.Buffer
+			mini.RenderError(&buf, test.Err, "", mini.StylePlain)
+			if buf.String() != test.Expected {
+				t.Errorf("expected %q, got %q", test.Expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestDiagnosticString(t *testing.T) {
+	_, err := mini.CompileFile("rules.mini", "if x = 1 { }")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	d := err.(*mini.Error).Diagnostic()
+	if s, expected := d.String(), "rules.mini:1:6: SyntaxError: Unexpected assignment in condition"; s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
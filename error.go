@@ -0,0 +1,264 @@
+package mini
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrorKind classifies an Error
+type ErrorKind int
+
+const (
+	ErrorRuntime ErrorKind = iota
+	ErrorUser
+	ErrorType
+	ErrorInvalidOp
+	ErrorZeroDivision
+	ErrorOverflow
+	ErrorIndex
+	ErrorValue
+	ErrorSyntax
+)
+
+var errorKindNames = []string{
+	ErrorRuntime:      "RuntimeError",
+	ErrorUser:         "UserError",
+	ErrorType:         "TypeError",
+	ErrorInvalidOp:    "InvalidOp",
+	ErrorZeroDivision: "ZeroDivisionError",
+	ErrorOverflow:     "OverflowError",
+	ErrorIndex:        "IndexError",
+	ErrorValue:        "ValueError",
+	ErrorSyntax:       "SyntaxError",
+}
+
+func (k ErrorKind) String() string {
+	if k < 0 || int(k) >= len(errorKindNames) {
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+	return errorKindNames[k]
+}
+
+// Error is a syntax or runtime error. It is both a Go error and an Object,
+// so that a script can catch and inspect it.
+type Error struct {
+	Kind ErrorKind
+	Msg  string
+	// Pos is where the error was raised, if HasPos is set, in File, which is
+	// empty if the source has no name. Span is the extent of the expression
+	// or token at fault.
+	Pos    Position
+	HasPos bool
+	File   string
+	Span   Span
+	// Hint suggests how to fix the error, if there is a likely fix
+	Hint string
+	// Trace lists the calls in progress when a runtime error was raised,
+	// innermost first
+	Trace []Frame
+	// Value is the object passed to raise, if it was not a string or Error
+	Value Object
+	// Err is the Go error which caused this one, if any
+	Err error
+}
+
+// NewError constructs a user Error with the given message
+func NewError(msg string) *Error {
+	return &Error{Kind: ErrorUser, Msg: msg}
+}
+
+// Cause returns the Go error underlying err, which is err itself unless it is
+// an Error wrapping another error
+func Cause(err error) error {
+	for {
+		e, ok := err.(*Error)
+		if !ok || e.Err == nil {
+			return err
+		}
+		err = e.Err
+	}
+}
+
+// wrapError converts err to an Error raised at pos by the expression with the
+// given span. An Error which already has a position is returned unchanged, so
+// the innermost position wins, as is a fatal error.
+func wrapError(err error, pos Position, span Span) error {
+	if isFatal(err) {
+		return err
+	}
+	e := asError(err)
+	if !e.HasPos {
+		e.Pos, e.HasPos, e.Span = pos, true, span
+	}
+	return e
+}
+
+// notFunctionError reports that callee, whose value is obj, is not a
+// function
+func notFunctionError(callee Expression, obj Object) error {
+	ident, ok := callee.(*Ident)
+	if !ok {
+		return asError(fmt.Errorf("TypeError: %v is not a function", callee))
+	}
+	// use the plain name, since a Symbol prints with a leading @
+	e := asError(fmt.Errorf("TypeError: %s is not a function", string(ident.Name)))
+	if obj == nil || obj.IsNil() {
+		e.Hint = fmt.Sprintf("%s is not defined", string(ident.Name))
+	}
+	return e
+}
+
+// asError converts err to an Error without a position, unless it already is
+// one
+func asError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return &Error{Kind: errorKindOf(err), Msg: err.Error(), Err: err}
+}
+
+// errorKindOf classifies a Go error by its sentinel value or by the kind
+// prefix of its message, as in "TypeError: ..."
+func errorKindOf(err error) ErrorKind {
+	switch err {
+	case ErrZeroDivision:
+		return ErrorZeroDivision
+	case ErrOverflow:
+		return ErrorOverflow
+	}
+	msg := err.Error()
+	for kind, name := range errorKindNames {
+		if strings.HasPrefix(msg, name+":") {
+			return ErrorKind(kind)
+		}
+	}
+	return ErrorRuntime
+}
+
+// newSyntaxError constructs a syntax Error at span in file
+func newSyntaxError(file string, span Span, msg string) *Error {
+	return &Error{Kind: ErrorSyntax, Msg: msg, Pos: span.Start, HasPos: true, File: file, Span: span}
+}
+
+// setFile records file as the source of e, if it has a position in an
+// unnamed source
+func setFile(err error, file string) {
+	if e, ok := err.(*Error); ok && e.HasPos && e.File == "" {
+		e.File = file
+	}
+}
+
+func (e *Error) Error() string {
+	if !e.HasPos {
+		return e.Msg
+	}
+	if e.File != "" {
+		return fmt.Sprintf("%s at %s:%v", e.Msg, e.File, e.Pos)
+	}
+	return fmt.Sprintf("%s at %v", e.Msg, e.Pos)
+}
+
+// Line returns the line on which e was raised, counting from 1, or 0 if it
+// has no position
+func (e *Error) Line() int {
+	if !e.HasPos {
+		return 0
+	}
+	return e.Pos.Row + 1
+}
+
+// Column returns the column at which e was raised, counting from 1, or 0 if
+// it has no position
+func (e *Error) Column() int {
+	if !e.HasPos {
+		return 0
+	}
+	return e.Pos.Col + 1
+}
+
+// Truthy helps Error implement the Object interface
+func (e *Error) Truthy() bool { return true }
+
+// IsNil helps Error implement the Object interface
+func (e *Error) IsNil() bool { return false }
+
+// Send helps Error implement the Object interface
+func (e *Error) Send(op Op, args Args) (Object, error) {
+	switch op {
+	case OpEq, OpNe:
+		rhs, ok := args.Arg(0).(*Error)
+		return Bool((ok && e == rhs) == (op == OpEq)), nil
+	}
+	return nil, NewErrInvalidOp(op, e)
+}
+
+// Eval helps Error implement the Expression interface
+func (e *Error) Eval(*Vm) (Object, error) { return e, nil }
+
+var errorMethods = map[string]func(*Error, Args) (Object, error){
+	"message": func(e *Error, args Args) (Object, error) {
+		return String(e.Msg), nil
+	},
+	"kind": func(e *Error, args Args) (Object, error) {
+		return String(e.Kind.String()), nil
+	},
+	"line": func(e *Error, args Args) (Object, error) {
+		if !e.HasPos {
+			return NIL, nil
+		}
+		return Int(e.Line()), nil
+	},
+	"column": func(e *Error, args Args) (Object, error) {
+		if !e.HasPos {
+			return NIL, nil
+		}
+		return Int(e.Column()), nil
+	},
+	"file": func(e *Error, args Args) (Object, error) {
+		if e.File == "" {
+			return NIL, nil
+		}
+		return String(e.File), nil
+	},
+	"traceback": func(e *Error, args Args) (Object, error) {
+		return String(e.Traceback()), nil
+	},
+	"value": func(e *Error, args Args) (Object, error) {
+		if e.Value == nil {
+			return NIL, nil
+		}
+		return e.Value, nil
+	},
+}
+
+// Method helps Error implement the Receiver interface
+func (e *Error) Method(name string) Function {
+	if m, ok := errorMethods[name]; ok {
+		return func(args Args) (Object, error) { return m(e, args) }
+	}
+	return nil
+}
+
+// newErrorBuiltin implements error(msg), which returns a user Error without
+// raising it
+func newErrorBuiltin(args Args) (Object, error) {
+	return newUserError(args.Arg(0)), nil
+}
+
+// raiseBuiltin implements raise(value), which raises value if it is an Error
+// and otherwise a user Error describing value
+func raiseBuiltin(args Args) (Object, error) {
+	if e, ok := args.Arg(0).(*Error); ok {
+		return nil, e
+	}
+	return nil, newUserError(args.Arg(0))
+}
+
+func newUserError(obj Object) *Error {
+	if s, ok := obj.(String); ok {
+		return NewError(string(s))
+	}
+	e := NewError(fmt.Sprint(obj))
+	e.Value = obj
+	return e
+}
@@ -0,0 +1,67 @@
+package mini
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// Hashable is implemented by objects which may be used as Map keys. Objects
+// with equal hash keys must also be equal under OpEq.
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
+// HashKey is a comparable value which identifies a Hashable object
+type HashKey struct {
+	Type  reflect.Type
+	Value interface{}
+}
+
+// HashKey helps Number implement the Hashable interface. Integral Numbers
+// hash like the equal Int.
+func (o Number) HashKey() HashKey {
+	f := float64(o)
+	if f == math.Floor(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return Int(f).HashKey()
+	}
+	return HashKey{numberType, f}
+}
+
+// HashKey helps Int implement the Hashable interface
+func (o Int) HashKey() HashKey { return HashKey{intType, int64(o)} }
+
+// HashKey helps BigInt implement the Hashable interface
+func (o BigInt) HashKey() HashKey { return ratHashKey(o.toRat()) }
+
+// HashKey helps Decimal implement the Hashable interface
+func (o Decimal) HashKey() HashKey { return ratHashKey(o.val) }
+
+// ratHashKey returns the hash key shared by every number equal to r, so that
+// it agrees with the hash keys of Int and Number
+func ratHashKey(r *big.Rat) HashKey {
+	if r.IsInt() && r.Num().IsInt64() {
+		return Int(r.Num().Int64()).HashKey()
+	}
+	if f, exact := r.Float64(); exact {
+		return HashKey{numberType, f}
+	}
+	return HashKey{decimalType, r.RatString()}
+}
+
+// HashKey helps String implement the Hashable interface
+func (o String) HashKey() HashKey { return HashKey{stringType, string(o)} }
+
+// HashKey helps Bool implement the Hashable interface
+func (o Bool) HashKey() HashKey { return HashKey{boolType, bool(o)} }
+
+// hashKeyOf returns the hash key of obj, or an error if obj is not Hashable
+func hashKeyOf(obj Object) (HashKey, error) {
+	h, ok := obj.(Hashable)
+	if !ok {
+		return HashKey{}, fmt.Errorf("TypeError: %T is not hashable", obj)
+	}
+	return h.HashKey(), nil
+}
@@ -0,0 +1,150 @@
+package mini
+
+import "math"
+
+// Int is a 64 bit integer type. Arithmetic on Ints which would overflow fails
+// with ErrOverflow.
+type Int int64
+
+// Truthy helps Int implement the Object interface
+func (o Int) Truthy() bool { return true }
+
+// IsNil helps Int implement the Object interface
+func (o Int) IsNil() bool { return false }
+
+// Send helps Int implement the Object interface. Division by / always yields
+// a Number; use ~/ for integer division.
+func (o Int) Send(op Op, args Args) (Object, error) {
+	return o.sendMetered(nil, op, args)
+}
+
+func (o Int) sendMetered(m *meter, op Op, args Args) (Object, error) {
+	if ret, ok, err := sendMixed(m, op, o, args.Arg(0)); ok {
+		return ret, err
+	}
+	switch op {
+	case OpNeg:
+		if o == math.MinInt64 {
+			return nil, ErrOverflow
+		}
+		return -o, nil
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpPow, OpFloorDiv, OpLt, OpLe, OpGt, OpGe, OpEq, OpNe:
+		rhs, ok := args.Arg(0).(Int)
+		if !ok {
+			return nil, newErrTypeBadRhs(op, o, args.Arg(0), intType)
+		}
+		switch op {
+		case OpAdd:
+			return addInt(o, rhs)
+		case OpSub:
+			if rhs == math.MinInt64 {
+				if o >= 0 {
+					return nil, ErrOverflow
+				}
+				return o - rhs, nil
+			}
+			return addInt(o, -rhs)
+		case OpMul:
+			return mulInt(o, rhs)
+		case OpDiv:
+			if rhs == 0 {
+				return nil, ErrZeroDivision
+			}
+			return Number(o) / Number(rhs), nil
+		case OpMod:
+			if rhs == 0 {
+				return nil, ErrZeroDivision
+			}
+			// the result takes the sign of the divisor, as for Number
+			r := o % rhs
+			if r != 0 && (r < 0) != (rhs < 0) {
+				r += rhs
+			}
+			return r, nil
+		case OpFloorDiv:
+			if rhs == 0 {
+				return nil, ErrZeroDivision
+			}
+			if o == math.MinInt64 && rhs == -1 {
+				return nil, ErrOverflow
+			}
+			q := o / rhs
+			if o%rhs != 0 && (o < 0) != (rhs < 0) {
+				q--
+			}
+			return q, nil
+		case OpPow:
+			return powInt(o, rhs)
+		case OpLt:
+			return Bool(o < rhs), nil
+		case OpLe:
+			return Bool(o <= rhs), nil
+		case OpGt:
+			return Bool(o > rhs), nil
+		case OpGe:
+			return Bool(o >= rhs), nil
+		case OpEq:
+			return Bool(o == rhs), nil
+		case OpNe:
+			return Bool(o != rhs), nil
+		}
+	}
+	return nil, NewErrInvalidOp(op, o)
+}
+
+// Eval helps Int implement the Expression interface
+func (o Int) Eval(*Vm) (Object, error) { return o, nil }
+
+// ToInt converts Int to an int
+func (o Int) ToInt() int { return int(o) }
+
+// ToInt64 converts Int to an int64
+func (o Int) ToInt64() int64 { return int64(o) }
+
+// NewIntFromInt64 constructs an Int from an int64
+func NewIntFromInt64(v int64) Int { return Int(v) }
+
+func addInt(a, b Int) (Object, error) {
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return nil, ErrOverflow
+	}
+	return a + b, nil
+}
+
+func mulInt(a, b Int) (Object, error) {
+	if a == 0 || b == 0 {
+		return Int(0), nil
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return nil, ErrOverflow
+	}
+	return c, nil
+}
+
+// powInt raises a to the power b by repeated squaring. Negative exponents
+// yield a Number.
+func powInt(a, b Int) (Object, error) {
+	if b < 0 {
+		return Number(math.Pow(float64(a), float64(b))), nil
+	}
+	result := Int(1)
+	for b > 0 {
+		if b&1 == 1 {
+			r, err := mulInt(result, a)
+			if err != nil {
+				return nil, err
+			}
+			result = r.(Int)
+		}
+		b >>= 1
+		if b > 0 {
+			sq, err := mulInt(a, a)
+			if err != nil {
+				return nil, err
+			}
+			a = sq.(Int)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package mini
+
+import "fmt"
+
+// Iterable is implemented by objects which a for-in loop can iterate over
+type Iterable interface {
+	Object
+	Iterate() Iterator
+}
+
+// Iterator steps through the elements of an Iterable. Next advances to the
+// next element and reports whether there is one; Key and Value return the
+// current element.
+type Iterator interface {
+	Next() bool
+	Key() Object
+	Value() Object
+}
+
+// iterate returns an iterator over obj, or an error if obj is not Iterable
+func iterate(obj Object) (Iterator, error) {
+	it, ok := obj.(Iterable)
+	if !ok {
+		return nil, fmt.Errorf("TypeError: %T is not iterable", obj)
+	}
+	return it.Iterate(), nil
+}
+
+// Iterate helps String implement the Iterable interface. It yields the index
+// and value of each rune.
+func (o String) Iterate() Iterator {
+	runes := []rune(string(o))
+	items := make([]Object, len(runes))
+	for i, r := range runes {
+		items[i] = String(r)
+	}
+	return &seqIterator{items: items, pos: -1}
+}
+
+// Iterate helps List implement the Iterable interface. It yields the index
+// and value of each item, including items appended during iteration.
+func (o *List) Iterate() Iterator {
+	return &listIterator{list: o, pos: -1}
+}
+
+// Iterate helps Map implement the Iterable interface. It yields the entries
+// present when iteration began, in insertion order.
+func (o *Map) Iterate() Iterator {
+	return &mapIterator{entries: append([]mapEntry(nil), o.entries...), pos: -1}
+}
+
+type seqIterator struct {
+	items []Object
+	pos   int
+}
+
+func (it *seqIterator) Next() bool {
+	if it.pos < len(it.items) {
+		it.pos++
+	}
+	return it.pos < len(it.items)
+}
+
+func (it *seqIterator) Key() Object { return Int(it.pos) }
+
+func (it *seqIterator) Value() Object { return it.items[it.pos] }
+
+type listIterator struct {
+	list *List
+	pos  int
+}
+
+func (it *listIterator) Next() bool {
+	if it.pos < len(it.list.Items) {
+		it.pos++
+	}
+	return it.pos < len(it.list.Items)
+}
+
+func (it *listIterator) Key() Object { return Int(it.pos) }
+
+func (it *listIterator) Value() Object { return it.list.Items[it.pos] }
+
+type mapIterator struct {
+	entries []mapEntry
+	pos     int
+}
+
+func (it *mapIterator) Next() bool {
+	if it.pos < len(it.entries) {
+		it.pos++
+	}
+	return it.pos < len(it.entries)
+}
+
+func (it *mapIterator) Key() Object { return it.entries[it.pos].Key }
+
+func (it *mapIterator) Value() Object { return it.entries[it.pos].Value }
@@ -0,0 +1,73 @@
+package mini
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lambda is a function defined by a mini script. It closes over the scope in
+// which it was defined. A Lambda created by the bytecode backend has a
+// compiled body instead of Body.
+type Lambda struct {
+	Params  []Symbol
+	Body    *Block
+	env     *Scope
+	vm      *Vm
+	proto   *funcProto
+	frame   *frame
+	globals *Scope
+}
+
+// Truthy helps Lambda implement the Object interface
+func (o *Lambda) Truthy() bool { return true }
+
+// IsNil helps Lambda implement the Object interface
+func (o *Lambda) IsNil() bool { return false }
+
+// Send helps Lambda implement the Object interface
+func (o *Lambda) Send(op Op, args Args) (Object, error) {
+	switch op {
+	case OpEq, OpNe:
+		rhs, ok := args.Arg(0).(*Lambda)
+		if !ok {
+			return nil, newErrTypeBadRhs(op, o, rhs, lambdaType)
+		}
+		if op == OpEq {
+			return Bool(o == rhs), nil
+		}
+		return Bool(o != rhs), nil
+	}
+	return nil, NewErrInvalidOp(op, o)
+}
+
+// Call helps Lambda implement the Callable interface. Each parameter is bound
+// to the argument at the same position, or NIL if there is no such argument.
+func (o *Lambda) Call(args Args) (Object, error) {
+	if err := o.vm.enterCall(); err != nil {
+		return nil, err
+	}
+	defer o.vm.leaveCall()
+	if o.proto != nil {
+		return o.vm.callCompiled(o, args)
+	}
+	scope := NewScope(o.env)
+	for i, param := range o.Params {
+		scope.Define(param, args.Arg(i))
+	}
+	obj, err := o.Body.evalIn(scope, o.vm)
+	if err != nil {
+		return nil, err
+	}
+	return o.vm.catchReturn(obj), nil
+}
+
+// Eval helps Lambda implement the Expression interface
+func (o *Lambda) Eval(*Vm) (Object, error) { return o, nil }
+
+func (o *Lambda) String() string {
+	params := make([]string, len(o.Params))
+	for i, param := range o.Params {
+		params[i] = string(param)
+	}
+	return fmt.Sprint("func(", strings.Join(params, ", "), ")")
+}
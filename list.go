@@ -0,0 +1,117 @@
+package mini
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// List is a mutable sequence of objects
+type List struct {
+	Items []Object
+	meter *meter
+}
+
+// NewList constructs a List containing items
+func NewList(items ...Object) *List {
+	return &List{Items: items}
+}
+
+// Truthy helps List implement the Object interface
+func (o *List) Truthy() bool { return len(o.Items) != 0 }
+
+// IsNil helps List implement the Object interface
+func (o *List) IsNil() bool { return false }
+
+// Send helps List implement the Object interface
+func (o *List) Send(op Op, args Args) (Object, error) {
+	return o.sendMetered(nil, op, args)
+}
+
+func (o *List) sendMetered(m *meter, op Op, args Args) (Object, error) {
+	switch op {
+	case OpAdd:
+		rhs, ok := args.Arg(0).(*List)
+		if !ok {
+			return nil, newErrTypeBadRhs(op, o, args.Arg(0), listType)
+		}
+		n := len(o.Items) + len(rhs.Items)
+		if err := m.charge(sizeHeader + sizeSlot*int64(n)); err != nil {
+			return nil, err
+		}
+		items := make([]Object, 0, n)
+		items = append(items, o.Items...)
+		return &List{Items: append(items, rhs.Items...), meter: m}, nil
+	case OpEq, OpNe:
+		rhs, ok := args.Arg(0).(*List)
+		if !ok {
+			return nil, newErrTypeBadRhs(op, o, args.Arg(0), listType)
+		}
+		eq := len(o.Items) == len(rhs.Items)
+		for i := 0; eq && i < len(o.Items); i++ {
+			eq = objectsEqual(o.Items[i], rhs.Items[i])
+		}
+		if op == OpEq {
+			return Bool(eq), nil
+		}
+		return Bool(!eq), nil
+	case OpIndex:
+		i, err := toIndex(o, args.Arg(0), len(o.Items))
+		if err != nil {
+			return nil, err
+		}
+		return o.Items[i], nil
+	case OpSetIndex:
+		i, err := toIndex(o, args.Arg(0), len(o.Items))
+		if err != nil {
+			return nil, err
+		}
+		o.Items[i] = args.Arg(1)
+		return args.Arg(1), nil
+	}
+	return nil, NewErrInvalidOp(op, o)
+}
+
+// Eval helps List implement the Expression interface
+func (o *List) Eval(*Vm) (Object, error) { return o, nil }
+
+func (o *List) String() string {
+	items := make([]string, len(o.Items))
+	for i, item := range o.Items {
+		items[i] = fmt.Sprint(item)
+	}
+	return fmt.Sprint("[", strings.Join(items, ", "), "]")
+}
+
+// toIndex converts idx to an offset into seq, which has the given length.
+// Negative indexes count back from the end of the sequence.
+func toIndex(seq, idx Object, length int) (int, error) {
+	var i int
+	switch n := idx.(type) {
+	case Int:
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return 0, newErrIndexOutOfRange(idx, length)
+		}
+		i = n.ToInt()
+	case Number:
+		if n.IsFloat() || n < math.MinInt32 || n > math.MaxInt32 {
+			return 0, newErrTypeBadRhs(OpIndex, seq, idx, intType)
+		}
+		i = n.ToInt()
+	default:
+		return 0, newErrTypeBadRhs(OpIndex, seq, idx, intType)
+	}
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		return 0, newErrIndexOutOfRange(idx, length)
+	}
+	return i, nil
+}
+
+// objectsEqual returns true if lhs considers itself equal to rhs
+func objectsEqual(lhs, rhs Object) bool {
+	eq, err := lhs.Send(OpEq, Args{rhs})
+	return err == nil && eq != nil && eq.Truthy()
+}
@@ -0,0 +1,305 @@
+package mini
+
+// frame holds the bindings of a scope which declares names. Slots are laid
+// out by the compiler.
+type frame struct {
+	slots  []binding
+	parent *frame
+}
+
+// binding is a frame slot. A slot is bound once anything, even a nil
+// Object, has been assigned to it; lookups skip unbound slots.
+type binding struct {
+	obj   Object
+	bound bool
+}
+
+// handler is an installed error handler. An error jumps to pc with the stack
+// cut back to sp and env restored.
+type handler struct {
+	pc, sp int
+	env    *frame
+}
+
+// run executes the compiled function f with the frame env, resolving free
+// names in globals. The operand stack is shared by nested calls; each run
+// only touches the values above the stack as it found it.
+func (vm *Vm) run(f *funcProto, env *frame, globals *Scope) (Object, error) {
+	base := len(vm.stack)
+	var handlers []handler
+	pc := 0
+	for {
+		in := f.code[pc]
+		pc++
+		var err error
+		switch in.op {
+		case opStep:
+			err = vm.step()
+		case opConst:
+			vm.push(f.consts[in.a])
+		case opPop:
+			vm.stack = vm.stack[:len(vm.stack)-1]
+		case opTruncate:
+			vm.stack = vm.stack[:len(vm.stack)-int(in.a)]
+		case opTruncateTo:
+			top := vm.stack[len(vm.stack)-1]
+			vm.stack = vm.stack[:len(vm.stack)-int(in.a)]
+			vm.stack[len(vm.stack)-1] = top
+		case opLoad:
+			vm.push(loadName(&f.refs[in.a], env, globals))
+		case opStore:
+			storeName(&f.refs[in.a], env, globals, vm.stack[len(vm.stack)-1])
+		case opDefine:
+			env.slots[in.a] = binding{obj: vm.pop(), bound: true}
+		case opEnter:
+			env = &frame{slots: make([]binding, in.a), parent: env}
+		case opLeave:
+			for n := in.a; n > 0; n-- {
+				env = env.parent
+			}
+		case opJump:
+			pc = int(in.a)
+		case opJumpIfFalse:
+			if !vm.pop().Truthy() {
+				pc = int(in.a)
+			}
+		case opAnd:
+			if !vm.stack[len(vm.stack)-1].Truthy() {
+				pc = int(in.a)
+			} else {
+				vm.pop()
+			}
+		case opOr:
+			if vm.stack[len(vm.stack)-1].Truthy() {
+				pc = int(in.a)
+			} else {
+				vm.pop()
+			}
+		case opFalsify:
+			if !vm.stack[len(vm.stack)-1].Truthy() {
+				vm.stack[len(vm.stack)-1] = FALSE
+			}
+		case opNot:
+			vm.stack[len(vm.stack)-1] = Bool(!vm.stack[len(vm.stack)-1].Truthy())
+		case opSend:
+			err = vm.send(&f.sites[in.a])
+		case opMethod:
+			s := &f.sites[in.a]
+			obj := vm.pop()
+			if err = vm.adopt(obj); err != nil {
+				break
+			}
+			fn, lerr := lookupMethod(obj, s.name)
+			if lerr != nil {
+				err = wrapError(lerr, s.pos, s.span)
+			} else {
+				vm.push(fn)
+			}
+		case opCallable:
+			if _, ok := vm.stack[len(vm.stack)-1].(Callable); !ok {
+				s := &f.sites[in.a]
+				err = wrapError(notFunctionError(s.callee, vm.stack[len(vm.stack)-1]), s.pos, s.span)
+			}
+		case opCall:
+			err = vm.call(&f.sites[in.a], f.file)
+		case opList:
+			n := len(vm.stack) - int(in.a)
+			items := make([]Object, in.a)
+			copy(items, vm.stack[n:])
+			vm.stack = vm.stack[:n]
+			list := NewList(items...)
+			err = vm.adopt(list)
+			vm.push(list)
+		case opMap:
+			m := NewMap()
+			err = vm.adopt(m)
+			vm.push(m)
+		case opMapSet:
+			n := len(vm.stack)
+			key, val := vm.stack[n-2], vm.stack[n-1]
+			vm.stack = vm.stack[:n-2]
+			if serr := vm.stack[n-3].(*Map).Set(key, val); serr != nil {
+				err = wrapError(serr, f.sites[in.a].pos, f.sites[in.a].span)
+			}
+		case opClosure:
+			fn := f.funcs[in.a]
+			vm.push(&Lambda{Params: fn.params, vm: vm, proto: fn, frame: env, globals: globals})
+		case opReturn:
+			ret := vm.pop()
+			vm.stack = vm.stack[:base]
+			return ret, nil
+		case opIter:
+			it, ierr := iterate(vm.stack[len(vm.stack)-1])
+			if ierr != nil {
+				err = wrapError(ierr, f.sites[in.a].pos, f.sites[in.a].span)
+			} else {
+				vm.stack[len(vm.stack)-1] = &iteration{it}
+			}
+		case opIterNext:
+			it := vm.stack[len(vm.stack)-1].(*iteration)
+			if !it.Next() {
+				vm.pop()
+				pc = int(in.a)
+			} else if in.b != 0 {
+				key := it.Key()
+				vm.push(it.Value())
+				vm.push(key)
+			} else {
+				vm.push(it.Value())
+			}
+		case opTry:
+			handlers = append(handlers, handler{pc: int(in.a), sp: len(vm.stack) - int(in.b), env: env})
+		case opEndTry:
+			handlers = handlers[:len(handlers)-1]
+		case opCatch:
+			vm.stack[len(vm.stack)-1] = asError(vm.stack[len(vm.stack)-1].(*caught).err)
+		case opRethrow:
+			err = vm.pop().(*caught).err
+		}
+		if err != nil {
+			setFile(err, f.file)
+			if len(handlers) == 0 || isFatal(err) {
+				vm.stack = vm.stack[:base]
+				return nil, err
+			}
+			h := handlers[len(handlers)-1]
+			handlers = handlers[:len(handlers)-1]
+			vm.stack = vm.stack[:h.sp]
+			vm.push(&caught{err})
+			pc, env = h.pc, h.env
+		}
+	}
+}
+
+func (vm *Vm) push(obj Object) {
+	vm.stack = append(vm.stack, obj)
+}
+
+func (vm *Vm) pop() Object {
+	obj := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return obj
+}
+
+// send performs the operation at s on the base and arguments on top of the
+// stack. The arguments are passed without copying them off the stack.
+func (vm *Vm) send(s *site) error {
+	n := len(vm.stack) - s.argc
+	lhs := vm.stack[n-1]
+	if err := vm.adopt(lhs); err != nil {
+		return err
+	}
+	ret, err := sendWith(&vm.meter, lhs, s.op, Args(vm.stack[n:len(vm.stack):len(vm.stack)]))
+	vm.stack = vm.stack[:n-1]
+	if err != nil {
+		return wrapError(err, s.pos, s.span)
+	}
+	if ret == nil {
+		return wrapError(NewErrInvalidOp(s.op, lhs), s.pos, s.span)
+	}
+	vm.push(ret)
+	return vm.adopt(ret)
+}
+
+// call calls the function beneath the arguments on top of the stack, from
+// the site s in file
+func (vm *Vm) call(s *site, file string) error {
+	n := len(vm.stack) - s.argc
+	fn := vm.stack[n-1].(Callable)
+	args := make(Args, s.argc)
+	copy(args, vm.stack[n:])
+	vm.stack = vm.stack[:n-1]
+	depth := vm.enterSite(s.callee, s.pos, file)
+	ret, err := vm.callFunction(fn, args)
+	if err != nil {
+		err = vm.callError(err, s.pos, s.span)
+	}
+	vm.sites = vm.sites[:depth]
+	if err != nil {
+		return err
+	}
+	vm.push(ret)
+	if _, ok := fn.(*Lambda); !ok {
+		return vm.account(ret)
+	}
+	return nil
+}
+
+// callCompiled calls a Lambda compiled to bytecode
+func (vm *Vm) callCompiled(o *Lambda, args Args) (Object, error) {
+	env := o.frame
+	if o.proto.frameSize > 0 {
+		env = &frame{slots: make([]binding, o.proto.frameSize), parent: env}
+		for i, slot := range o.proto.paramSlots {
+			env.slots[slot] = binding{obj: args.Arg(i), bound: true}
+		}
+	}
+	return vm.run(o.proto, env, o.globals)
+}
+
+// loadName returns the value bound to the name r refers to, or NIL
+func loadName(r *nameRef, env *frame, globals *Scope) Object {
+	for _, s := range r.slots {
+		fr := env
+		for d := s.depth; d > 0; d-- {
+			fr = fr.parent
+		}
+		if b := fr.slots[s.slot]; b.bound {
+			if b.obj == nil {
+				return NIL
+			}
+			return b.obj
+		}
+	}
+	if obj := globals.Lookup(r.name); obj != nil {
+		return obj
+	}
+	return NIL
+}
+
+// storeName assigns obj to the name r refers to, following Scope.Assign: the
+// nearest binding is updated, or else the name is defined in the current
+// scope, which is either the innermost frame or the global scope.
+func storeName(r *nameRef, env *frame, globals *Scope, obj Object) {
+	for _, s := range r.slots {
+		fr := env
+		for d := s.depth; d > 0; d-- {
+			fr = fr.parent
+		}
+		if fr.slots[s.slot].bound {
+			fr.slots[s.slot].obj = obj
+			return
+		}
+	}
+	if owner := globals.Resolve(r.name); owner != nil {
+		owner.Symbols[r.name] = obj
+		return
+	}
+	if len(r.slots) > 0 && r.slots[0].depth == 0 {
+		env.slots[r.slots[0].slot] = binding{obj: obj, bound: true}
+		return
+	}
+	globals.Define(r.name, obj)
+}
+
+// iteration holds a running iterator on the operand stack
+type iteration struct {
+	Iterator
+}
+
+func (o *iteration) Truthy() bool { return true }
+
+func (o *iteration) IsNil() bool { return false }
+
+func (o *iteration) Send(op Op, args Args) (Object, error) { return nil, NewErrInvalidOp(op, o) }
+
+// caught holds an error on the operand stack while it is being handled
+type caught struct {
+	err error
+}
+
+func (o *caught) Truthy() bool { return true }
+
+func (o *caught) IsNil() bool { return false }
+
+func (o *caught) Send(op Op, args Args) (Object, error) { return nil, NewErrInvalidOp(op, o) }
@@ -0,0 +1,140 @@
+package mini
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Map is a mutable mapping from Hashable keys to objects. It remembers the
+// order in which keys were first inserted.
+type Map struct {
+	entries []mapEntry
+	index   map[HashKey]int
+	meter   *meter
+}
+
+type mapEntry struct {
+	Key   Object
+	Value Object
+}
+
+// NewMap constructs an empty Map
+func NewMap() *Map {
+	return &Map{index: make(map[HashKey]int)}
+}
+
+// Len returns the number of entries in the map
+func (o *Map) Len() int { return len(o.entries) }
+
+// Get returns the value stored under key, and whether there is one
+func (o *Map) Get(key Object) (Object, bool, error) {
+	hk, err := hashKeyOf(key)
+	if err != nil {
+		return nil, false, err
+	}
+	i, ok := o.index[hk]
+	if !ok {
+		return nil, false, nil
+	}
+	return o.entries[i].Value, true, nil
+}
+
+// Set stores value under key, which must be Hashable
+func (o *Map) Set(key, value Object) error {
+	hk, err := hashKeyOf(key)
+	if err != nil {
+		return err
+	}
+	if i, ok := o.index[hk]; ok {
+		o.entries[i].Value = value
+		return nil
+	}
+	if err := o.meter.charge(sizeEntry); err != nil {
+		return err
+	}
+	o.index[hk] = len(o.entries)
+	o.entries = append(o.entries, mapEntry{Key: key, Value: value})
+	return nil
+}
+
+// Delete removes the value stored under key and returns it, if there was one
+func (o *Map) Delete(key Object) (Object, bool, error) {
+	hk, err := hashKeyOf(key)
+	if err != nil {
+		return nil, false, err
+	}
+	i, ok := o.index[hk]
+	if !ok {
+		return nil, false, nil
+	}
+	val := o.entries[i].Value
+	o.entries = append(o.entries[:i], o.entries[i+1:]...)
+	delete(o.index, hk)
+	for j := i; j < len(o.entries); j++ {
+		hk, _ := hashKeyOf(o.entries[j].Key)
+		o.index[hk] = j
+	}
+	return val, true, nil
+}
+
+// Keys returns the keys of the map in insertion order
+func (o *Map) Keys() []Object {
+	keys := make([]Object, len(o.entries))
+	for i, entry := range o.entries {
+		keys[i] = entry.Key
+	}
+	return keys
+}
+
+// Truthy helps Map implement the Object interface
+func (o *Map) Truthy() bool { return len(o.entries) != 0 }
+
+// IsNil helps Map implement the Object interface
+func (o *Map) IsNil() bool { return false }
+
+// Send helps Map implement the Object interface
+func (o *Map) Send(op Op, args Args) (Object, error) {
+	switch op {
+	case OpEq, OpNe:
+		rhs, ok := args.Arg(0).(*Map)
+		if !ok {
+			return nil, newErrTypeBadRhs(op, o, args.Arg(0), mapType)
+		}
+		eq := o.Len() == rhs.Len()
+		for i := 0; eq && i < len(o.entries); i++ {
+			var val Object
+			val, eq, _ = rhs.Get(o.entries[i].Key)
+			eq = eq && objectsEqual(o.entries[i].Value, val)
+		}
+		if op == OpEq {
+			return Bool(eq), nil
+		}
+		return Bool(!eq), nil
+	case OpIndex:
+		val, ok, err := o.Get(args.Arg(0))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return NIL, nil
+		}
+		return val, nil
+	case OpSetIndex:
+		if err := o.Set(args.Arg(0), args.Arg(1)); err != nil {
+			return nil, err
+		}
+		return args.Arg(1), nil
+	}
+	return nil, NewErrInvalidOp(op, o)
+}
+
+// Eval helps Map implement the Expression interface
+func (o *Map) Eval(*Vm) (Object, error) { return o, nil }
+
+func (o *Map) String() string {
+	entries := make([]string, len(o.entries))
+	for i, entry := range o.entries {
+		entries[i] = fmt.Sprint(entry.Key, ": ", entry.Value)
+	}
+	return fmt.Sprint("{", strings.Join(entries, ", "), "}")
+}
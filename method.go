@@ -0,0 +1,273 @@
+package mini
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Receiver is implemented by objects which expose named methods to scripts,
+// as in value.method(args). Method returns nil if there is no method with
+// the given name.
+type Receiver interface {
+	Object
+	Method(name string) Function
+}
+
+// CallMethod invokes the method called name on obj
+func (vm *Vm) CallMethod(obj Object, name string, args Args) (Object, error) {
+	fn, err := lookupMethod(obj, name)
+	if err != nil {
+		return nil, err
+	}
+	return fn.Call(args)
+}
+
+func lookupMethod(obj Object, name string) (Function, error) {
+	if r, ok := obj.(Receiver); ok {
+		if fn := r.Method(name); fn != nil {
+			return fn, nil
+		}
+	}
+	return nil, fmt.Errorf("TypeError: %T has no method %q", obj, name)
+}
+
+var stringMethods = map[string]func(String, Args) (Object, error){
+	"len": func(o String, args Args) (Object, error) {
+		return Int(len([]rune(string(o)))), nil
+	},
+	"upper": func(o String, args Args) (Object, error) {
+		return String(strings.ToUpper(string(o))), nil
+	},
+	"lower": func(o String, args Args) (Object, error) {
+		return String(strings.ToLower(string(o))), nil
+	},
+	"trim": func(o String, args Args) (Object, error) {
+		return String(strings.TrimSpace(string(o))), nil
+	},
+	"contains": func(o String, args Args) (Object, error) {
+		sub, ok := args.Arg(0).(String)
+		if !ok {
+			return nil, newTypeError(0, stringType, args.Arg(0))
+		}
+		return Bool(strings.Contains(string(o), string(sub))), nil
+	},
+	"replace": func(o String, args Args) (Object, error) {
+		old, ok := args.Arg(0).(String)
+		if !ok {
+			return nil, newTypeError(0, stringType, args.Arg(0))
+		}
+		repl, ok := args.Arg(1).(String)
+		if !ok {
+			return nil, newTypeError(1, stringType, args.Arg(1))
+		}
+		n := int64(strings.Count(string(o), string(old)))
+		if int64(len(o))+n*int64(len(repl)-len(old)) > maxStringLen {
+			return nil, errStringTooLong
+		}
+		return String(strings.Replace(string(o), string(old), string(repl), -1)), nil
+	},
+	"split": func(o String, args Args) (Object, error) {
+		sep, ok := args.Arg(0).(String)
+		if !ok {
+			return nil, newTypeError(0, stringType, args.Arg(0))
+		}
+		var items []Object
+		for _, part := range strings.Split(string(o), string(sep)) {
+			items = append(items, String(part))
+		}
+		return NewList(items...), nil
+	},
+}
+
+// Method helps String implement the Receiver interface
+func (o String) Method(name string) Function {
+	if m, ok := stringMethods[name]; ok {
+		return func(args Args) (Object, error) { return m(o, args) }
+	}
+	return nil
+}
+
+var numberMethods = map[string]func(Number, Args) (Object, error){
+	"abs": func(o Number, args Args) (Object, error) {
+		return Number(math.Abs(float64(o))), nil
+	},
+	"floor": func(o Number, args Args) (Object, error) {
+		return Number(math.Floor(float64(o))), nil
+	},
+	"ceil": func(o Number, args Args) (Object, error) {
+		return Number(math.Ceil(float64(o))), nil
+	},
+	"round": func(o Number, args Args) (Object, error) {
+		return Number(math.Floor(float64(o) + 0.5)), nil
+	},
+}
+
+// Method helps Number implement the Receiver interface
+func (o Number) Method(name string) Function {
+	if m, ok := numberMethods[name]; ok {
+		return func(args Args) (Object, error) { return m(o, args) }
+	}
+	return nil
+}
+
+var intMethods = map[string]func(Int, Args) (Object, error){
+	"abs": func(o Int, args Args) (Object, error) {
+		if o < 0 {
+			return o.Send(OpNeg, nil)
+		}
+		return o, nil
+	},
+	"floor": func(o Int, args Args) (Object, error) { return o, nil },
+	"ceil":  func(o Int, args Args) (Object, error) { return o, nil },
+	"round": func(o Int, args Args) (Object, error) { return o, nil },
+}
+
+// Method helps Int implement the Receiver interface
+func (o Int) Method(name string) Function {
+	if m, ok := intMethods[name]; ok {
+		return func(args Args) (Object, error) { return m(o, args) }
+	}
+	return nil
+}
+
+var bigIntMethods = map[string]func(BigInt, Args) (Object, error){
+	"abs": func(o BigInt, args Args) (Object, error) {
+		return BigInt{new(big.Int).Abs(o.val)}, nil
+	},
+	"floor": func(o BigInt, args Args) (Object, error) { return o, nil },
+	"ceil":  func(o BigInt, args Args) (Object, error) { return o, nil },
+	"round": func(o BigInt, args Args) (Object, error) { return o, nil },
+}
+
+// Method helps BigInt implement the Receiver interface
+func (o BigInt) Method(name string) Function {
+	if m, ok := bigIntMethods[name]; ok {
+		return func(args Args) (Object, error) { return m(o, args) }
+	}
+	return nil
+}
+
+var decimalMethods = map[string]func(Decimal, Args) (Object, error){
+	"abs": func(o Decimal, args Args) (Object, error) {
+		return Decimal{new(big.Rat).Abs(o.val)}, nil
+	},
+	"floor": func(o Decimal, args Args) (Object, error) {
+		return Decimal{floorRat(o.val)}, nil
+	},
+	"ceil": func(o Decimal, args Args) (Object, error) {
+		neg := floorRat(new(big.Rat).Neg(o.val))
+		return Decimal{neg.Neg(neg)}, nil
+	},
+	// round takes an optional number of decimal places
+	"round": func(o Decimal, args Args) (Object, error) {
+		places := 0
+		if !args.Empty() {
+			n, ok := args.Arg(0).(Int)
+			if !ok {
+				return nil, newTypeError(0, intType, args.Arg(0))
+			}
+			places = int(n)
+		}
+		return o.Round(places), nil
+	},
+}
+
+// Method helps Decimal implement the Receiver interface
+func (o Decimal) Method(name string) Function {
+	if m, ok := decimalMethods[name]; ok {
+		return func(args Args) (Object, error) { return m(o, args) }
+	}
+	return nil
+}
+
+var listMethods = map[string]func(*List, Args) (Object, error){
+	"len": func(o *List, args Args) (Object, error) {
+		return Int(len(o.Items)), nil
+	},
+	"push": func(o *List, args Args) (Object, error) {
+		if err := o.meter.charge(sizeSlot * int64(len(args))); err != nil {
+			return nil, err
+		}
+		o.Items = append(o.Items, args...)
+		return o, nil
+	},
+	"pop": func(o *List, args Args) (Object, error) {
+		if len(o.Items) == 0 {
+			return nil, newErrIndexOutOfRange(Int(-1), 0)
+		}
+		last := o.Items[len(o.Items)-1]
+		o.Items = o.Items[:len(o.Items)-1]
+		return last, nil
+	},
+	"contains": func(o *List, args Args) (Object, error) {
+		for _, item := range o.Items {
+			if objectsEqual(item, args.Arg(0)) {
+				return TRUE, nil
+			}
+		}
+		return FALSE, nil
+	},
+	"join": func(o *List, args Args) (Object, error) {
+		sep, ok := args.Arg(0).(String)
+		if !ok {
+			return nil, newTypeError(0, stringType, args.Arg(0))
+		}
+		parts := make([]string, len(o.Items))
+		n := int64(len(sep)) * int64(len(parts))
+		for i, item := range o.Items {
+			parts[i] = fmt.Sprint(item)
+			if n += int64(len(parts[i])); n > maxStringLen {
+				return nil, errStringTooLong
+			}
+		}
+		return String(strings.Join(parts, string(sep))), nil
+	},
+}
+
+// Method helps List implement the Receiver interface
+func (o *List) Method(name string) Function {
+	if m, ok := listMethods[name]; ok {
+		return func(args Args) (Object, error) { return m(o, args) }
+	}
+	return nil
+}
+
+var mapMethods = map[string]func(*Map, Args) (Object, error){
+	"len": func(o *Map, args Args) (Object, error) {
+		return Int(o.Len()), nil
+	},
+	"keys": func(o *Map, args Args) (Object, error) {
+		return NewList(o.Keys()...), nil
+	},
+	"values": func(o *Map, args Args) (Object, error) {
+		values := make([]Object, len(o.entries))
+		for i, entry := range o.entries {
+			values[i] = entry.Value
+		}
+		return NewList(values...), nil
+	},
+	"has": func(o *Map, args Args) (Object, error) {
+		_, ok, err := o.Get(args.Arg(0))
+		if err != nil {
+			return nil, err
+		}
+		return Bool(ok), nil
+	},
+	"delete": func(o *Map, args Args) (Object, error) {
+		val, ok, err := o.Delete(args.Arg(0))
+		if err != nil || !ok {
+			return NIL, err
+		}
+		return val, nil
+	},
+}
+
+// Method helps Map implement the Receiver interface
+func (o *Map) Method(name string) Function {
+	if m, ok := mapMethods[name]; ok {
+		return func(args Args) (Object, error) { return m(o, args) }
+	}
+	return nil
+}
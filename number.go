@@ -2,7 +2,7 @@ package mini
 
 import "math"
 
-// Number is a number type. There is not int data type.
+// Number is a floating point number type. See Int for integers.
 type Number float64
 
 // Truthy helps Number implement the Object interface
@@ -13,13 +13,16 @@ func (o Number) IsNil() bool { return false }
 
 // Send helps Number implement the Object interface
 func (o Number) Send(op Op, args Args) (Object, error) {
+	if ret, ok, err := sendMixed(nil, op, o, args.Arg(0)); ok {
+		return ret, err
+	}
 	switch op {
 	case OpNeg:
 		return -o, nil
-	case OpAdd, OpSub, OpMul, OpDiv, OpLt, OpLe, OpGt, OpGe, OpEq, OpNe:
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpPow, OpFloorDiv, OpLt, OpLe, OpGt, OpGe, OpEq, OpNe:
 		rhs, ok := args.Arg(0).(Number)
 		if !ok {
-			return nil, newErrTypeBadRhs(op, o, rhs, numberType)
+			return nil, newErrTypeBadRhs(op, o, args.Arg(0), numberType)
 		}
 		switch op {
 		case OpAdd:
@@ -33,6 +36,20 @@ func (o Number) Send(op Op, args Args) (Object, error) {
 				return nil, ErrZeroDivision
 			}
 			return o / rhs, nil
+		case OpMod:
+			// the result takes the sign of the divisor, so that
+			// a == (a ~/ b) * b + a % b
+			if rhs == 0 {
+				return nil, ErrZeroDivision
+			}
+			return o - rhs*Number(math.Floor(float64(o/rhs))), nil
+		case OpPow:
+			return Number(math.Pow(float64(o), float64(rhs))), nil
+		case OpFloorDiv:
+			if rhs == 0 {
+				return nil, ErrZeroDivision
+			}
+			return Number(math.Floor(float64(o / rhs))), nil
 		case OpLt:
 			return Bool(o < rhs), nil
 		case OpLe:
@@ -41,6 +58,10 @@ func (o Number) Send(op Op, args Args) (Object, error) {
 			return Bool(o > rhs), nil
 		case OpGe:
 			return Bool(o >= rhs), nil
+		case OpEq:
+			return Bool(o == rhs), nil
+		case OpNe:
+			return Bool(o != rhs), nil
 		}
 	}
 	return nil, NewErrInvalidOp(op, o)
@@ -49,7 +70,8 @@ func (o Number) Send(op Op, args Args) (Object, error) {
 // Eval helps Number implement the Expression interface
 func (o Number) Eval(*Vm) (Object, error) { return o, nil }
 
-// ToInt converts Number to an int
+// ToInt converts Number to an int, truncating any fractional component. The
+// result is undefined if o is out of the range of an int.
 func (o Number) ToInt() int { return int(o) }
 
 // ToFloat converts Number to a float64
@@ -57,7 +79,7 @@ func (o Number) ToFloat() float64 { return float64(o) }
 
 // IsFloat returns true if there is a fractional component to o
 func (o Number) IsFloat() bool {
-	return float64(o) == math.Floor(float64(o))
+	return float64(o) != math.Floor(float64(o))
 }
 
 // NewNumberFromFloat constructs a Number from a float64
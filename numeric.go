@@ -0,0 +1,148 @@
+package mini
+
+import (
+	"math"
+	"math/big"
+)
+
+// Ranks of the numeric types. A binary operation on two numbers of different
+// types first promotes the operand of lower rank to the type of the other, so
+// Int < BigInt < Decimal < Number. Mixing an exact type with a Number yields a
+// Number, since most Numbers have no exact decimal meaning.
+const (
+	rankInt = iota
+	rankBigInt
+	rankDecimal
+	rankNumber
+)
+
+// numeric is implemented by the builtin number types
+type numeric interface {
+	Object
+	numericRank() int
+	// promote converts the receiver to the type with the given rank, which
+	// is at least as high as its own
+	promote(rank int) numeric
+	// toRat converts the receiver to an exact fraction, or returns nil if it
+	// is not finite
+	toRat() *big.Rat
+}
+
+// sendMixed performs a binary operation between numbers of different types.
+// It reports false if rhs is not a number of a different type than lhs.
+func sendMixed(m *meter, op Op, lhs numeric, arg Object) (Object, bool, error) {
+	rhs, ok := arg.(numeric)
+	if !ok || rhs.numericRank() == lhs.numericRank() {
+		return nil, false, nil
+	}
+	switch op {
+	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
+		// compare exactly rather than risk rounding either operand
+		cmp, ordered := compareNumeric(lhs, rhs)
+		return compareResult(op, cmp, ordered), true, nil
+	case OpAdd, OpSub, OpMul, OpDiv, OpMod, OpPow, OpFloorDiv:
+		rank := lhs.numericRank()
+		if rhs.numericRank() > rank {
+			rank = rhs.numericRank()
+		}
+		ret, err := sendWith(m, lhs.promote(rank), op, Args{rhs.promote(rank)})
+		return ret, true, err
+	}
+	return nil, false, nil
+}
+
+// compareNumeric compares two numbers exactly. It reports false if they are
+// unordered, which is only the case if either is NaN.
+func compareNumeric(lhs, rhs numeric) (int, bool) {
+	l, r := lhs.toRat(), rhs.toRat()
+	if l != nil && r != nil {
+		return l.Cmp(r), true
+	}
+	// at least one side is not finite, which a float comparison handles
+	lf, rf := float64(lhs.promote(rankNumber).(Number)), float64(rhs.promote(rankNumber).(Number))
+	switch {
+	case lf < rf:
+		return -1, true
+	case lf > rf:
+		return 1, true
+	case lf == rf:
+		return 0, true
+	}
+	return 0, false
+}
+
+// compareResult converts the result of a comparison to the result of op
+func compareResult(op Op, cmp int, ordered bool) Bool {
+	if !ordered {
+		return Bool(op == OpNe)
+	}
+	switch op {
+	case OpEq:
+		return cmp == 0
+	case OpNe:
+		return cmp != 0
+	case OpLt:
+		return cmp < 0
+	case OpLe:
+		return cmp <= 0
+	case OpGt:
+		return cmp > 0
+	case OpGe:
+		return cmp >= 0
+	}
+	return false
+}
+
+func (o Int) numericRank() int { return rankInt }
+
+func (o Int) promote(rank int) numeric {
+	switch rank {
+	case rankBigInt:
+		return NewBigIntFromInt64(int64(o))
+	case rankDecimal:
+		return Decimal{o.toRat()}
+	case rankNumber:
+		return Number(o)
+	}
+	return o
+}
+
+func (o Int) toRat() *big.Rat { return new(big.Rat).SetInt64(int64(o)) }
+
+func (o BigInt) numericRank() int { return rankBigInt }
+
+func (o BigInt) promote(rank int) numeric {
+	switch rank {
+	case rankDecimal:
+		return Decimal{o.toRat()}
+	case rankNumber:
+		f, _ := new(big.Float).SetInt(o.val).Float64()
+		return Number(f)
+	}
+	return o
+}
+
+func (o BigInt) toRat() *big.Rat { return new(big.Rat).SetInt(o.val) }
+
+func (o Decimal) numericRank() int { return rankDecimal }
+
+func (o Decimal) promote(rank int) numeric {
+	if rank == rankNumber {
+		f, _ := o.val.Float64()
+		return Number(f)
+	}
+	return o
+}
+
+func (o Decimal) toRat() *big.Rat { return o.ToRat() }
+
+func (o Number) numericRank() int { return rankNumber }
+
+func (o Number) promote(rank int) numeric { return o }
+
+func (o Number) toRat() *big.Rat {
+	if math.IsInf(float64(o), 0) || math.IsNaN(float64(o)) {
+		return nil
+	}
+	return new(big.Rat).SetFloat64(float64(o))
+}
@@ -12,10 +12,15 @@ const (
 	OpSub
 	OpMul
 	OpDiv
+	OpMod
+	OpPow
+	OpFloorDiv
 	OpLt
 	OpLe
 	OpGt
 	OpGe
+	OpIndex
+	OpSetIndex
 )
 
 func (o Op) String() string {
@@ -36,6 +41,12 @@ func (o Op) String() string {
 		return "mul"
 	case OpDiv:
 		return "div"
+	case OpMod:
+		return "mod"
+	case OpPow:
+		return "pow"
+	case OpFloorDiv:
+		return "floordiv"
 	case OpLt:
 		return "lt"
 	case OpLe:
@@ -44,6 +55,10 @@ func (o Op) String() string {
 		return "gt"
 	case OpGe:
 		return "ge"
+	case OpIndex:
+		return "index"
+	case OpSetIndex:
+		return "setindex"
 	}
 	return "?"
 }
@@ -1,44 +1,190 @@
 package mini
 
 import (
-	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
 type Parser struct {
-	s        *Scanner
-	last     Token
-	haveLast bool
+	s            *Scanner
+	file         string
+	last         Token
+	haveLast     bool
+	afterNewline bool     // true if last was preceded by a newline
+	sawNewline   bool     // true if a newline was scanned since the last token
+	operand      bool     // true if the last token may end an operand
+	statement    bool     // true if the next expression begins a statement
+	loops        []string // labels of the enclosing loops, innermost last
+	end          Position // end of the last token consumed
+	prevEnd      Position // end of the token consumed before it
+	errs         []*Error // syntax errors reported so far
 }
 
 func NewParser(r io.Reader) *Parser {
 	return &Parser{s: NewScanner(r)}
 }
 
+// NewFileParser constructs a Parser whose errors refer to the named file
+func NewFileParser(file string, r io.Reader) *Parser {
+	return &Parser{s: NewScanner(r), file: file}
+}
+
+// Parse parses the whole input. After a syntax error it skips to the next
+// statement or the end of the enclosing block and carries on, so it returns
+// the partial AST of the statements it could parse, along with the first
+// error. Diagnostics returns all of the errors.
 func (p *Parser) Parse() (Expression, error) {
-	return p.parseExpressionBlock(false)
+	expr := p.parseExpressionBlock(false, Position{})
+	if len(p.errs) > 0 {
+		return expr, p.errs[0]
+	}
+	return expr, nil
+}
+
+// Diagnostics describes the syntax errors found by Parse, in order
+func (p *Parser) Diagnostics() []Diagnostic {
+	diags := make([]Diagnostic, len(p.errs))
+	for i, e := range p.errs {
+		diags[i] = e.Diagnostic()
+	}
+	return diags
+}
+
+// report records a syntax error, unless one was already reported at the same
+// position, since recovering from the first often causes the second
+func (p *Parser) report(err error) {
+	e := asError(err)
+	if n := len(p.errs); n > 0 && p.errs[n-1].Pos == e.Pos {
+		return
+	}
+	p.errs = append(p.errs, e)
+}
+
+// synchronize skips the rest of a statement after a syntax error, up to the
+// next token which begins a line or, if enclosed, the end of the block.
+// Brackets are skipped as a whole. If force is set, the first token is
+// skipped regardless, so that the parser makes progress.
+func (p *Parser) synchronize(enclosed, force bool) {
+	depth := 0
+	for first := true; ; first = false {
+		tok := p.scanIgnoreWhitespace()
+		if tok.Type == EOF {
+			p.unscanToken()
+			return
+		}
+		if !(first && force) && depth == 0 &&
+			(p.afterNewline || enclosed && tok.Type == CURLYCLOSE) {
+			p.unscanToken()
+			return
+		}
+		switch tok.Type {
+		case ROUNDOPEN, SQUAREOPEN, CURLYOPEN:
+			depth++
+		case ROUNDCLOSE, SQUARECLOSE, CURLYCLOSE:
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+}
+
+// errorf returns a syntax error at span
+func (p *Parser) errorf(span Span, format string, args ...interface{}) *Error {
+	return newSyntaxError(p.file, span, fmt.Sprintf(format, args...))
+}
+
+// tokenSpan returns the span of tok
+func tokenSpan(tok Token) Span {
+	return Span{Start: tok.Start, End: tok.End}
+}
+
+// span returns the span from start to the end of the last token consumed
+func (p *Parser) span(start Position) Span {
+	return Span{Start: start, End: p.end}
+}
+
+// setSpan records the span from start to the end of the last token consumed
+// on expr
+func (p *Parser) setSpan(expr Expression, start Position) {
+	if e, ok := expr.(interface {
+		setSpan(Span)
+	}); ok {
+		e.setSpan(p.span(start))
+	}
 }
 
 func (p *Parser) scanToken() Token {
+	tok := p.nextToken()
+	switch tok.Type {
+	case WS:
+	case EOF:
+		// the end of input has no extent
+		p.prevEnd = p.end
+	default:
+		p.prevEnd, p.end = p.end, tok.End
+	}
+	return tok
+}
+
+func (p *Parser) nextToken() Token {
 	if p.haveLast {
 		p.haveLast = false
 		return p.last
 	}
 
-	p.last = p.s.Scan()
+	tok := p.s.Scan()
+	if tok.Type == COMMENT {
+		if p.operand && !p.sawNewline && looksLikeOperand(tok.Value) {
+			e := p.errorf(Span{tok.Start, tok.Start}, "// begins a comment, not a floor division")
+			e.Hint = "floor division is written ~/"
+			p.report(e)
+		}
+		// comments are whitespace to the parser
+		tok.Type = WS
+	}
+	if tok.Type == WS {
+		p.sawNewline = p.sawNewline || strings.Contains(tok.Value, "\n")
+	} else {
+		p.afterNewline = p.sawNewline
+		p.sawNewline = false
+		p.operand = endsOperand(tok.Type)
+	}
+	p.last = tok
 	return p.last
 }
 
+// endsOperand returns true if a token of type tt may be the last of an
+// operand, so that a binary operator may follow it
+func endsOperand(tt TokenType) bool {
+	switch tt {
+	case IDENT, NUMBER, STRING, BOOL, ROUNDCLOSE, SQUARECLOSE:
+		return true
+	}
+	return false
+}
+
+// looksLikeOperand returns true if the text of a line comment could be meant
+// as the right operand of a floor division, as in 7 // 2, since mini spells
+// floor division ~/. That is the case if it begins with a digit or an opening
+// parenthesis, as prose rarely does.
+func looksLikeOperand(comment string) bool {
+	text := strings.TrimLeft(strings.TrimPrefix(comment, "//"), " \t")
+	return text != "" && (isNumber(rune(text[0])) || text[0] == '(')
+}
+
+// unscanToken pushes back the last token, which must not be whitespace
 func (p *Parser) unscanToken() {
 	p.haveLast = true
+	p.end = p.prevEnd
 }
 
 func (p *Parser) scanIgnoreWhitespace() Token {
 	tok := p.scanToken()
-	if tok.Type == WS {
-		return p.scanToken()
+	for tok.Type == WS {
+		tok = p.scanToken()
 	}
 	return tok
 }
@@ -52,130 +198,402 @@ func (p *Parser) accept(tt TokenType) bool {
 	return false
 }
 
+// peekInline returns the next non-whitespace token without consuming it, and
+// whether it is on the same line as the token before it
+func (p *Parser) peekInline() (Token, bool) {
+	tok := p.scanIgnoreWhitespace()
+	p.unscanToken()
+	return tok, !p.afterNewline
+}
+
+// acceptInline is like accept, but fails if the next token is on a new line
+func (p *Parser) acceptInline(tt TokenType) (Token, bool) {
+	tok, inline := p.peekInline()
+	if inline && tok.Type == tt {
+		p.scanToken()
+		return tok, true
+	}
+	return tok, false
+}
+
 func (p *Parser) parseExpression(expect bool) (Expression, error) {
+	return p.parseBinaryExpression(precLowest, expect)
+}
+
+// parseBinaryExpression parses an operand followed by any binary operators
+// which bind tighter than prec. Operators of equal precedence associate to
+// the left, except for exponentiation.
+func (p *Parser) parseBinaryExpression(prec int, expect bool) (Expression, error) {
+	lhs, err := p.parseUnaryExpression(expect)
+	if err != nil || lhs == nil {
+		return lhs, err
+	}
+	for {
+		next := p.scanIgnoreWhitespace()
+		nextPrec := getBinaryPrecedence(next.Type)
+		if nextPrec <= prec {
+			p.unscanToken()
+			return lhs, nil
+		}
+		rhsPrec := nextPrec
+		if isRightAssociative(next.Type) {
+			rhsPrec--
+		}
+		rhs, err := p.parseBinaryExpression(rhsPrec, true)
+		if err != nil {
+			return nil, err
+		}
+		start := SpanOf(lhs).Start
+		lhs = newBinaryExpression(next, lhs, rhs)
+		p.setSpan(lhs, start)
+	}
+}
+
+func (p *Parser) parseUnaryExpression(expect bool) (Expression, error) {
+	tok := p.scanIgnoreWhitespace()
+	switch tok.Type {
+	case NOT, SUBTRACT:
+		p.statement = false
+		expr, err := p.parseBinaryExpression(precUnary, true)
+		if err != nil {
+			return nil, err
+		}
+		if tok.Type == NOT {
+			return &NotExpr{Span: p.span(tok.Start), Expr: expr}, nil
+		}
+		return &OpExpr{Span: p.span(tok.Start), Base: expr, Op: getUnaryOp(tok.Type), Pos: tok.Start}, nil
+	}
+	p.unscanToken()
+	return p.parsePrimaryExpression(expect)
+}
+
+func (p *Parser) parsePrimaryExpression(expect bool) (Expression, error) {
+	statement := p.statement
+	p.statement = false
 	tok := p.scanIgnoreWhitespace()
 	var (
 		expr Expression
 		err  error
+		// postfix is set for the expressions which calls, index expressions
+		// and selectors may follow
+		postfix bool
 	)
 	switch tok.Type {
 	case STRING:
-		expr = NewStringFromString(tok.Value)
+		expr, postfix = &Literal{Value: NewStringFromString(tok.Value)}, true
 	case NUMBER:
-		expr, err = convertTokenToNumber(tok)
+		var val Object
+		if val, err = convertTokenToNumber(tok); err != nil {
+			e := p.errorf(tokenSpan(tok), "%v", err)
+			switch {
+			case strings.HasPrefix(err.Error(), "Unknown number suffix"):
+				e.Hint = "use n for a BigInt or d for a Decimal"
+			case strings.HasPrefix(err.Error(), "Integer literal"):
+				e.Hint = "use n for a BigInt"
+			}
+			err = e
+		}
+		expr, postfix = &Literal{Value: val}, true
 	case BOOL:
-		expr, err = convertTokenToBool(tok)
+		var val Bool
+		if val, err = convertTokenToBool(tok); err != nil {
+			err = p.errorf(tokenSpan(tok), "%v", err)
+		}
+		expr, postfix = &Literal{Value: val}, true
 	case IDENT:
-		if p.accept(ROUNDOPEN) {
-			expr, err = p.parseFunctionCall(tok.Value)
-		} else if p.accept(ASSIGN) {
-			expr, err = p.parseAssignment(tok.Value)
+		if p.accept(ASSIGN) {
+			expr, err = p.parseAssignment(tok.Value, p.last.Start)
+		} else if statement && p.accept(COLON) {
+			expr, err = p.parseLabelledLoop(tok)
 		} else {
-			expr = Symbol(tok.Value)
+			expr, postfix = &Ident{Name: Symbol(tok.Value)}, true
 		}
-	case NOT:
-		expr, err = p.parseNotExpression()
-	case SUBTRACT:
-		expr, err = p.parseUnaryExpression(tok.Type)
 	case ROUNDOPEN:
 		expr, err = p.parseParenthesizedExpression()
+		postfix = true
+	case SQUAREOPEN:
+		expr, err = p.parseListLiteral()
+		postfix = true
+	case CURLYOPEN:
+		expr, err = p.parseMapLiteral()
+		postfix = true
 	case IF:
 		expr, err = p.parseIfExpression()
 	case FOR:
-		expr, err = p.parseForExpression()
+		expr, err = p.parseForExpression("")
+	case BREAK, CONTINUE:
+		expr, err = p.parseLoopControl(tok)
+	case RETURN:
+		expr, err = p.parseReturn()
+	case FUNC:
+		expr, err = p.parseFuncLiteral()
+	case TRY:
+		expr, err = p.parseTryExpression()
+	case ILLEGAL:
+		err = p.illegalTokenError(tok)
 	}
-	// Short-circuit if we have an error at this point
 	if err != nil {
 		return nil, err
 	}
-	// Now we need to lookahead one token to check if this expression is part of a BinExpr
-	next := p.scanIgnoreWhitespace()
-	switch next.Type {
-	case AND:
-		expr, err = p.parseAndExpression(expr)
-	case OR:
-		expr, err = p.parseOrExpression(expr)
-	case ADD, SUBTRACT, MULTIPLY, DIVIDE, LESS, LESSEQUAL, GREATER, GREATEREQUAL, EQUAL, NOTEQUAL:
-		expr, err = p.parseBinaryExpression(expr, next.Type)
-	default:
-		p.unscanToken()
+	if expr == nil {
+		if expect {
+			// leave the token for the enclosing block to recover at
+			p.unscanToken()
+			return nil, p.errorf(tokenSpan(tok), "Expected expression")
+		}
+		return nil, nil
 	}
-	if expr == nil && expect {
-		err = fmt.Errorf("Expected expression")
+	p.setSpan(expr, tok.Start)
+	if postfix {
+		return p.parsePostfix(expr)
 	}
-	return expr, err
+	return expr, nil
 }
 
-func (p *Parser) parseAndExpression(lhs Expression) (Expression, error) {
-	rhs, err := p.parseExpression(true)
+func (p *Parser) parseFunctionCall(fn Expression, pos Position) (Expression, error) {
+	args, err := p.parseExpressionList(ROUNDCLOSE)
 	if err != nil {
 		return nil, err
 	}
-	return &AndExpr{LHS: lhs, RHS: rhs}, nil
+	return &CallExpr{Span: p.span(SpanOf(fn).Start), Func: fn, Args: args, Pos: pos}, nil
 }
 
-func (p *Parser) parseOrExpression(lhs Expression) (Expression, error) {
+func (p *Parser) parseAssignment(sym string, pos Position) (Expression, error) {
 	rhs, err := p.parseExpression(true)
 	if err != nil {
 		return nil, err
 	}
-	return &OrExpr{LHS: lhs, RHS: rhs}, nil
+	return &AssignExpr{Name: Symbol(sym), Expr: rhs, Pos: pos}, nil
 }
 
-func (p *Parser) parseNotExpression() (Expression, error) {
-	expr, err := p.parseExpression(true)
+func (p *Parser) parseParenthesizedExpression() (Expression, error) {
+	expressions, err := p.parseExpressionList(ROUNDCLOSE)
 	if err != nil {
 		return nil, err
 	}
-	return &NotExpr{Expr: expr}, nil
+	return &Tree{Exprs: expressions}, nil
 }
 
-func (p *Parser) parseFunctionCall(sym string) (Expression, error) {
-	args, err := p.parseExpressionList()
+func (p *Parser) parseListLiteral() (Expression, error) {
+	items, err := p.parseExpressionList(SQUARECLOSE)
 	if err != nil {
 		return nil, err
 	}
-	return &CallExpr{Name: Symbol(sym), Args: args}, nil
+	return &ListExpr{Items: items}, nil
 }
 
-func (p *Parser) parseAssignment(sym string) (Expression, error) {
+// parseMapLiteral parses the entries of a map literal. Blocks are never
+// parsed as expressions, so an opening brace in expression position always
+// begins a map literal.
+func (p *Parser) parseMapLiteral() (Expression, error) {
+	m := MapExpr{}
+	for !p.accept(CURLYCLOSE) {
+		if p.accept(EOF) {
+			e := p.errorf(tokenSpan(p.last), "Unexpected end of input")
+			e.Hint = "is a closing } missing?"
+			return nil, e
+		}
+		key, err := p.parseExpression(true)
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(COLON) {
+			e := p.errorf(tokenSpan(p.last), "Expected :")
+			e.Hint = "map entries are written key: value"
+			return nil, e
+		}
+		val, err := p.parseExpression(true)
+		if err != nil {
+			return nil, err
+		}
+		m.Keys = append(m.Keys, key)
+		m.Values = append(m.Values, val)
+		p.accept(COMMA)
+	}
+	return &m, nil
+}
+
+// parsePostfix parses any calls, index expressions and selectors which
+// follow base. Calls and index expressions must begin on the same line as
+// base, but a selector may begin a new line to continue a chain. An index
+// expression followed by an assignment becomes an index assignment.
+func (p *Parser) parsePostfix(base Expression) (Expression, error) {
+	for {
+		var err error
+		if p.accept(DOT) {
+			base, err = p.parseSelector(base, p.last.Start)
+		} else if tok, ok := p.acceptInline(ROUNDOPEN); ok {
+			base, err = p.parseFunctionCall(base, tok.Start)
+		} else if tok, ok := p.acceptInline(SQUAREOPEN); ok {
+			base, err = p.parseIndex(base, tok.Start)
+			if err == nil && p.accept(ASSIGN) {
+				return p.parseIndexAssignment(base.(*OpExpr))
+			}
+		} else {
+			return base, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *Parser) parseSelector(base Expression, pos Position) (Expression, error) {
+	tok := p.scanIgnoreWhitespace()
+	if tok.Type != IDENT {
+		return nil, p.errorf(tokenSpan(tok), "Expected method name")
+	}
+	return &SelectorExpr{Span: p.span(SpanOf(base).Start), Base: base, Name: tok.Value, Pos: pos}, nil
+}
+
+func (p *Parser) parseIndex(base Expression, pos Position) (Expression, error) {
+	idx, err := p.parseExpression(true)
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept(SQUARECLOSE) {
+		return nil, p.errorf(tokenSpan(p.last), "Expected ]")
+	}
+	return &OpExpr{Span: p.span(SpanOf(base).Start), Base: base, Args: []Expression{idx}, Op: OpIndex, Pos: pos}, nil
+}
+
+func (p *Parser) parseIndexAssignment(index *OpExpr) (Expression, error) {
 	rhs, err := p.parseExpression(true)
 	if err != nil {
 		return nil, err
 	}
-	return &AssignExpr{Name: Symbol(sym), Expr: rhs}, nil
+	args := []Expression{index.Args[0], rhs}
+	return &OpExpr{Span: p.span(index.Start), Base: index.Base, Args: args, Op: OpSetIndex, Pos: index.Pos}, nil
 }
 
-func (p *Parser) parseUnaryExpression(tt TokenType) (Expression, error) {
-	expr, err := p.parseExpression(true)
+func (p *Parser) parseLabelledLoop(label Token) (Expression, error) {
+	if !p.accept(FOR) {
+		return nil, p.errorf(tokenSpan(label), "Expected for after label %q", label.Value)
+	}
+	return p.parseForExpression(label.Value)
+}
+
+func (p *Parser) parseForExpression(label string) (Expression, error) {
+	p.loops = append(p.loops, label)
+	expr, err := p.parseForClauses(label)
+	p.loops = p.loops[:len(p.loops)-1]
+	return expr, err
+}
+
+// parseForClauses parses either a conditional loop or, if the condition is a
+// name followed by in or a comma, a for-in loop
+func (p *Parser) parseForClauses(label string) (Expression, error) {
+	cond, err := p.parseCondition()
 	if err != nil {
 		return nil, err
 	}
-	return &OpExpr{Base: expr, Op: getUnaryOp(tt)}, nil
+	if ident, ok := cond.(*Ident); ok {
+		if p.accept(IN) {
+			return p.parseForIn(label, "", ident.Name)
+		}
+		if p.accept(COMMA) {
+			tok := p.scanIgnoreWhitespace()
+			if tok.Type != IDENT {
+				return nil, p.errorf(tokenSpan(tok), "Expected loop variable")
+			}
+			if !p.accept(IN) {
+				return nil, p.errorf(Span{tok.End, tok.End}, "Expected in after loop variables")
+			}
+			return p.parseForIn(label, ident.Name, Symbol(tok.Value))
+		}
+	}
+	cb, err := p.parseConditionalBlock(cond)
+	if err != nil {
+		return nil, err
+	}
+	return &ForExpr{Label: label, For: cb}, nil
 }
 
-func (p *Parser) parseBinaryExpression(lhs Expression, tt TokenType) (Expression, error) {
-	rhs, err := p.parseExpression(true)
+func (p *Parser) parseForIn(label string, key, value Symbol) (Expression, error) {
+	iter, err := p.parseExpression(true)
 	if err != nil {
 		return nil, err
 	}
-	return &OpExpr{Base: lhs, Args: []Expression{rhs}, Op: getBinaryOp(tt)}, nil
+	body, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	return &ForInExpr{Label: label, Key: key, Value: value, Iter: iter, Body: body}, nil
 }
 
-func (p *Parser) parseParenthesizedExpression() (Expression, error) {
-	expressions, err := p.parseExpressionList()
+// parseTryExpression parses a try block followed by a catch block, a
+// finally block or both. The catch block may name the caught error.
+func (p *Parser) parseTryExpression() (Expression, error) {
+	body, err := p.parseBlock()
 	if err != nil {
 		return nil, err
 	}
-	return &Tree{Children: expressions}, nil
+	try := &TryExpr{Body: body}
+	if p.accept(CATCH) {
+		if tok, ok := p.acceptInline(IDENT); ok {
+			try.Name = Symbol(tok.Value)
+		}
+		if try.Catch, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept(FINALLY) {
+		if try.Finally, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	}
+	if try.Catch == nil && try.Finally == nil {
+		return nil, p.errorf(Span{p.end, p.end}, "Expected catch or finally after try block")
+	}
+	return try, nil
 }
 
-func (p *Parser) parseForExpression() (Expression, error) {
-	cb, err := p.parseConditional()
+// parseBlock parses a required enclosed block
+func (p *Parser) parseBlock() (*Block, error) {
+	if !p.accept(CURLYOPEN) {
+		return nil, p.errorf(tokenSpan(p.last), "Expected block")
+	}
+	return p.parseExpressionBlock(true, p.last.Start).(*Block), nil
+}
+
+func (p *Parser) parseLoopControl(tok Token) (Expression, error) {
+	if len(p.loops) == 0 {
+		return nil, p.errorf(tokenSpan(tok), "Unexpected %s outside of a loop", tok.Value)
+	}
+	var label string
+	if ident, ok := p.acceptInline(IDENT); ok {
+		label = ident.Value
+		if !p.inLoop(label) {
+			return nil, p.errorf(tokenSpan(ident), "Unknown loop label %q", label)
+		}
+	}
+	if tok.Type == BREAK {
+		return &BreakExpr{Label: label}, nil
+	}
+	return &ContinueExpr{Label: label}, nil
+}
+
+func (p *Parser) parseReturn() (Expression, error) {
+	tok, inline := p.peekInline()
+	switch {
+	case !inline, tok.Type == EOF, tok.Type == CURLYCLOSE, tok.Type == ROUNDCLOSE, tok.Type == COMMA:
+		// a bare return ends the statement
+		return &ReturnExpr{}, nil
+	}
+	expr, err := p.parseExpression(true)
 	if err != nil {
 		return nil, err
 	}
-	return &ForExpr{For: cb}, nil
+	return &ReturnExpr{Expr: expr}, nil
+}
+
+func (p *Parser) inLoop(label string) bool {
+	for _, l := range p.loops {
+		if l == label {
+			return true
+		}
+	}
+	return false
 }
 
 func (p *Parser) parseIfExpression() (Expression, error) {
@@ -195,63 +613,199 @@ func (p *Parser) parseIfExpression() (Expression, error) {
 	return &ifExpr, nil
 }
 
-func (p *Parser) parseConditional() (ConditionalBlock, error) {
-	cb := ConditionalBlock{}
-	if p.accept(CURLYOPEN) {
-		// skip the condition block
-		cb.Condition = TRUE
-	} else {
-		cond, err := p.parseExpression(true)
-		if err != nil {
-			return cb, err
+func (p *Parser) parseFuncLiteral() (Expression, error) {
+	if !p.accept(ROUNDOPEN) {
+		return nil, p.errorf(tokenSpan(p.last), "Expected parameter list")
+	}
+	var params []Symbol
+	for !p.accept(ROUNDCLOSE) {
+		tok := p.scanIgnoreWhitespace()
+		if tok.Type != IDENT {
+			return nil, p.errorf(tokenSpan(tok), "Expected parameter name")
 		}
-		cb.Condition = cond
+		params = append(params, Symbol(tok.Value))
+		p.accept(COMMA)
 	}
 	if !p.accept(CURLYOPEN) {
-		return cb, errors.New("Expected block") // FIXME position info error
+		return nil, p.errorf(tokenSpan(p.last), "Expected block")
 	}
-	block, err := p.parseExpressionBlock(true)
+	// loop control does not cross function boundaries
+	loops := p.loops
+	p.loops = nil
+	body := p.parseExpressionBlock(true, p.last.Start)
+	p.loops = loops
+	return &FuncExpr{Params: params, Body: body.(*Block)}, nil
+}
+
+func (p *Parser) parseConditional() (ConditionalBlock, error) {
+	cond, err := p.parseCondition()
 	if err != nil {
-		return cb, err
+		return ConditionalBlock{}, err
+	}
+	return p.parseConditionalBlock(cond)
+}
+
+// parseCondition parses the condition before a block, which is true if it is
+// omitted. An assignment must be parenthesized to be used as a condition,
+// since it is most likely a mistyped comparison.
+func (p *Parser) parseCondition() (Expression, error) {
+	if p.accept(CURLYOPEN) {
+		p.unscanToken()
+		return TRUE, nil
 	}
-	cb.Block = block
+	cond, err := p.parseExpression(true)
+	if assign, ok := cond.(*AssignExpr); ok {
+		end := assign.Pos
+		end.Col++
+		e := p.errorf(Span{assign.Pos, end}, "Unexpected assignment in condition")
+		e.Hint = "did you mean ==?"
+		return nil, e
+	}
+	return cond, err
+}
+
+func (p *Parser) parseConditionalBlock(cond Expression) (ConditionalBlock, error) {
+	cb := ConditionalBlock{Condition: cond}
+	if !p.accept(CURLYOPEN) {
+		return cb, p.errorf(tokenSpan(p.last), "Expected block")
+	}
+	cb.Block = p.parseExpressionBlock(true, p.last.Start)
 	return cb, nil
 }
 
-func (p *Parser) parseExpressionBlock(enclosed bool) (Expression, error) {
+// parseExpressionBlock parses a sequence of expressions starting at start. An
+// enclosed sequence is a Block which ends with a closing brace. Syntax errors
+// in the sequence are reported and skipped, so the result is never nil.
+func (p *Parser) parseExpressionBlock(enclosed bool, start Position) Expression {
 	var expressions []Expression
 	for {
 		if enclosed && p.accept(CURLYCLOSE) {
 			break
 		}
+		p.statement = true
+		end := p.end
 		expr, err := p.parseExpression(false)
-		if err != nil {
-			return nil, err
+		if err == nil && expr == nil {
+			// the token which ends the sequence has been consumed
+			tok := p.last
+			if tok.Type == EOF {
+				if enclosed {
+					e := p.errorf(tokenSpan(tok), "Unexpected end of input")
+					e.Hint = "is a closing } missing?"
+					p.report(e)
+				}
+				break
+			}
+			err = p.errorf(tokenSpan(tok), "Unexpected %q", tok.Value)
 		}
-		if expr == nil {
-			break
+		if err != nil {
+			p.report(err)
+			p.synchronize(enclosed, p.end == end)
+			continue
 		}
 		expressions = append(expressions, expr)
 	}
-	return &Tree{Children: expressions}, nil
+	if enclosed {
+		return &Block{Span: p.span(start), Exprs: expressions}
+	}
+	return &Tree{Span: p.span(start), Exprs: expressions}
 }
 
-func (p *Parser) parseExpressionList() ([]Expression, error) {
+func (p *Parser) parseExpressionList(closer TokenType) ([]Expression, error) {
 	var expressions []Expression
 	for {
-		if p.accept(ROUNDCLOSE) {
+		if p.accept(closer) {
 			break
 		}
+		if p.accept(EOF) {
+			e := p.errorf(tokenSpan(p.last), "Unexpected end of input")
+			e.Hint = fmt.Sprintf("is a closing %s missing?", closerText[closer])
+			return nil, e
+		}
 		expr, err := p.parseExpression(false)
 		if err != nil {
 			return nil, err
 		}
+		if expr == nil && p.last.Type == COMMA {
+			// an empty element, as in f(1,,2)
+			return nil, p.errorf(tokenSpan(p.last), "Expected expression")
+		}
+		if expr == nil {
+			// leave the token for the enclosing block to recover at
+			tok := p.last
+			p.unscanToken()
+			e := p.errorf(tokenSpan(tok), "Unexpected %q", tok.Value)
+			e.Hint = fmt.Sprintf("is a closing %s missing?", closerText[closer])
+			return nil, e
+		}
 		expressions = append(expressions, expr)
 		p.accept(COMMA)
 	}
 	return expressions, nil
 }
 
+func (p *Parser) illegalTokenError(tok Token) error {
+	if err, ok := p.s.Err().(*ScanError); ok {
+		e := newSyntaxError(p.file, Span{err.Pos, err.Pos}, err.Msg)
+		e.Err = err
+		return e
+	}
+	return p.errorf(tokenSpan(tok), "Unexpected %q", tok.Value)
+}
+
+var closerText = map[TokenType]string{
+	ROUNDCLOSE:  ")",
+	SQUARECLOSE: "]",
+	CURLYCLOSE:  "}",
+}
+
+// Precedence levels of the binary operators, from loosest to tightest
+const (
+	precLowest = iota
+	precOr
+	precAnd
+	precEquality
+	precComparison
+	precAdditive
+	precMultiplicative
+	precUnary
+	precPower
+)
+
+func getBinaryPrecedence(tt TokenType) int {
+	switch tt {
+	case OR:
+		return precOr
+	case AND:
+		return precAnd
+	case EQUAL, NOTEQUAL:
+		return precEquality
+	case LESS, LESSEQUAL, GREATER, GREATEREQUAL:
+		return precComparison
+	case ADD, SUBTRACT:
+		return precAdditive
+	case MULTIPLY, DIVIDE, MODULO, FLOORDIVIDE:
+		return precMultiplicative
+	case POWER:
+		return precPower
+	}
+	return precLowest
+}
+
+func isRightAssociative(tt TokenType) bool {
+	return tt == POWER
+}
+
+func newBinaryExpression(op Token, lhs, rhs Expression) Expression {
+	switch op.Type {
+	case AND:
+		return &AndExpr{LHS: lhs, RHS: rhs}
+	case OR:
+		return &OrExpr{LHS: lhs, RHS: rhs}
+	}
+	return &OpExpr{Base: lhs, Args: []Expression{rhs}, Op: getBinaryOp(op.Type), Pos: op.Start}
+}
+
 func getUnaryOp(tt TokenType) Op {
 	switch tt {
 	case SUBTRACT:
@@ -270,6 +824,12 @@ func getBinaryOp(tt TokenType) Op {
 		return OpMul
 	case DIVIDE:
 		return OpDiv
+	case MODULO:
+		return OpMod
+	case POWER:
+		return OpPow
+	case FLOORDIVIDE:
+		return OpFloorDiv
 	case LESS:
 		return OpLt
 	case LESSEQUAL:
@@ -286,11 +846,44 @@ func getBinaryOp(tt TokenType) Op {
 	return OpNoop
 }
 
-// FIXME should catch parse errors at lexing
-func convertTokenToNumber(t Token) (Number, error) {
-	val, err := strconv.ParseFloat(t.Value, 64)
+// convertTokenToNumber converts a NUMBER token to an Int or a Number, or to a
+// BigInt or a Decimal if it has an n or d suffix. The scanner has already
+// rejected exponents, so the token is digits and decimal points followed by
+// an optional suffix.
+func convertTokenToNumber(t Token) (Object, error) {
+	n := strings.IndexFunc(t.Value, func(ch rune) bool { return !isNumber(ch) && ch != '.' })
+	if n < 0 {
+		n = len(t.Value)
+	}
+	lit, suffix := t.Value[:n], t.Value[n:]
+	if strings.Count(lit, ".") > 1 {
+		return nil, fmt.Errorf("Malformed number literal %q", t.Value)
+	}
+	integral := !strings.Contains(lit, ".")
+	switch suffix {
+	case "":
+	case "n":
+		if !integral {
+			return nil, fmt.Errorf("Expected an integer before the n suffix: %q", t.Value)
+		}
+		val, _ := new(big.Int).SetString(lit, 10)
+		return BigInt{val}, nil
+	case "d":
+		val, _ := new(big.Rat).SetString(lit)
+		return Decimal{val}, nil
+	default:
+		return nil, fmt.Errorf("Unknown number suffix %q", suffix)
+	}
+	if integral {
+		val, err := strconv.ParseInt(lit, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Integer literal %s is out of range", lit)
+		}
+		return NewIntFromInt64(val), nil
+	}
+	val, err := strconv.ParseFloat(lit, 64)
 	if err != nil {
-		return 0, fmt.Errorf("Expected a number at %v: %v", t.Start, err)
+		return nil, fmt.Errorf("Number literal %s is out of range", lit)
 	}
 	return NewNumberFromFloat(val), nil
 }
@@ -298,7 +891,7 @@ func convertTokenToNumber(t Token) (Number, error) {
 func convertTokenToBool(t Token) (Bool, error) {
 	val, err := strconv.ParseBool(t.Value)
 	if err != nil {
-		return false, fmt.Errorf("Expected a bool at %v: %v", t.Start, err)
+		return false, fmt.Errorf("Expected a bool: %v", err)
 	}
 	return NewBoolFromBool(val), nil
 }
@@ -2,6 +2,7 @@ package mini_test
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -31,8 +32,28 @@ func TestParserParse(t *testing.T) {
 		},
 		{
 			"(,,)",
+			true,
+			"",
+		},
+		{
+			"f(1,,2)",
+			true,
+			"",
+		},
+		{
+			"print(1,,2)",
+			true,
+			"",
+		},
+		{
+			"(1,,2)",
+			true,
+			"",
+		},
+		{
+			"f(1, 2,)",
 			false,
-			"Tree[Tree[<nil>]]", // FIXME we should optimize out empty branches
+			"Tree[@f[1 2]]",
 		},
 		{
 			"print(foo)",
@@ -74,6 +95,286 @@ func TestParserParse(t *testing.T) {
 			false,
 			"Tree[@foo=@bar]",
 		},
+		{
+			"f = func(a, b) { a }",
+			false,
+			"Tree[@f=Func[@a @b] Block[@a]]",
+		},
+		{
+			"func() {}",
+			false,
+			"Tree[Func[] Block[]]",
+		},
+		{
+			"func(a, 1) {}",
+			true,
+			"",
+		},
+		{
+			"func(a)",
+			true,
+			"",
+		},
+		{
+			"for { break }",
+			false,
+			"Tree[For(Cond(true=>Block[Break]))]",
+		},
+		{
+			"for x { if y { continue } }",
+			false,
+			"Tree[For(Cond(@x=>Block[If(Cond(@y=>Block[Continue]) Cond(<nil>=><nil>))]))]",
+		},
+		{
+			"outer: for { for { break outer } }",
+			false,
+			"Tree[outer:For(Cond(true=>Block[For(Cond(true=>Block[Break(outer)]))]))]",
+		},
+		{
+			"for { break\nfoo }",
+			false,
+			"Tree[For(Cond(true=>Block[Break @foo]))]",
+		},
+		{
+			"for x in xs { print(x) }",
+			false,
+			"Tree[ForIn(@x in @xs Block[@print[@x]])]",
+		},
+		{
+			"outer: for k, v in m { break outer }",
+			false,
+			"Tree[outer:ForIn(@k @v in @m Block[Break(outer)])]",
+		},
+		{
+			"for k, in m {}",
+			true,
+			"",
+		},
+		{
+			"for k, v m {}",
+			true,
+			"",
+		},
+		{
+			"try { a } catch e { b } finally { c }",
+			false,
+			"Tree[Try(Block[@a] Catch(@e Block[@b]) Finally(Block[@c]))]",
+		},
+		{
+			"try { a } catch { b }",
+			false,
+			"Tree[Try(Block[@a] Catch(Block[@b]))]",
+		},
+		{
+			"try { a }",
+			true,
+			"",
+		},
+		{
+			"break",
+			true,
+			"",
+		},
+		{
+			"continue",
+			true,
+			"",
+		},
+		{
+			"for { break inner }",
+			true,
+			"",
+		},
+		{
+			"for { func() { break } }",
+			true,
+			"",
+		},
+		{
+			"outer: foo",
+			true,
+			"",
+		},
+		{
+			"[1, 2, [3]]",
+			false,
+			"Tree[List[1 2 List[3]]]",
+		},
+		{
+			"[]",
+			false,
+			"Tree[List[]]",
+		},
+		{
+			"[1, 2",
+			true,
+			"",
+		},
+		{
+			"xs[0][-1]",
+			false,
+			"Tree[Op{index}[Op{index}[@xs 0] Op{neg}[1]]]",
+		},
+		{
+			"xs[0] = 1",
+			false,
+			"Tree[Op{setindex}[@xs 0 1]]",
+		},
+		{
+			"f()[0]",
+			false,
+			"Tree[Op{index}[@f[] 0]]",
+		},
+		{
+			"xs\n[0]",
+			false,
+			"Tree[@xs List[0]]",
+		},
+		{
+			"xs[0",
+			true,
+			"",
+		},
+		{
+			"{\"a\": 1, b: [2]}",
+			false,
+			"Tree[Map[a:1 @b:List[2]]]",
+		},
+		{
+			"{}",
+			false,
+			"Tree[Map[]]",
+		},
+		{
+			"m[\"a\"] = {}",
+			false,
+			"Tree[Op{setindex}[@m a Map[]]]",
+		},
+		{
+			"if { 1 } else { 2 }",
+			false,
+			"Tree[If(Cond(true=>Block[1]) Cond(true=>Block[2]))]",
+		},
+		{
+			"if x { {1: 2} }",
+			false,
+			"Tree[If(Cond(@x=>Block[Map[1:2]]) Cond(<nil>=><nil>))]",
+		},
+		{
+			"{\"a\" 1}",
+			true,
+			"",
+		},
+		{
+			"{\"a\": 1",
+			true,
+			"",
+		},
+		{
+			"foo // comment\nbar",
+			false,
+			"Tree[@foo @bar]",
+		},
+		{
+			"foo /* a\nb */ + /**/ bar",
+			false,
+			"Tree[Op{add}[@foo @bar]]",
+		},
+		{
+			"print(foo, // first\n  bar) // done",
+			false,
+			"Tree[@print[@foo @bar]]",
+		},
+		{
+			"for { break // out\nfoo }",
+			false,
+			"Tree[For(Cond(true=>Block[Break @foo]))]",
+		},
+		{
+			"xs /* c */ [0]",
+			false,
+			"Tree[Op{index}[@xs 0]]",
+		},
+		{
+			"xs /* \n */ [0]",
+			false,
+			"Tree[@xs List[0]]",
+		},
+		{
+			"foo /* bar",
+			true,
+			"",
+		},
+		{
+			"foo @ bar",
+			true,
+			"",
+		},
+		{
+			"\"abc\".upper()",
+			false,
+			"Tree[abc.upper[]]",
+		},
+		{
+			"xs.push(1).len()",
+			false,
+			"Tree[@xs.push[1].len[]]",
+		},
+		{
+			"xs\n  .push(1)\n  .len()",
+			false,
+			"Tree[@xs.push[1].len[]]",
+		},
+		{
+			"f = xs.len",
+			false,
+			"Tree[@f=@xs.len]",
+		},
+		{
+			"f(1)(2) xs[0](1)",
+			false,
+			"Tree[@f[1][2] Op{index}[@xs 0][1]]",
+		},
+		{
+			"1.abs() -1.5.floor()",
+			false,
+			"Tree[Op{sub}[1.abs[] 1.5.floor[]]]",
+		},
+		{
+			"f\n(1)",
+			false,
+			"Tree[@f Tree[1]]",
+		},
+		{
+			"xs.",
+			true,
+			"",
+		},
+		{
+			"[1,,2]",
+			true,
+			"",
+		},
+		{
+			"return",
+			false,
+			"Tree[Return]",
+		},
+		{
+			"return\nfoo",
+			false,
+			"Tree[Return @foo]",
+		},
+		{
+			"func(a) { return a }",
+			false,
+			"Tree[Func[@a] Block[Return[@a]]]",
+		},
+		{
+			"func() { return }",
+			false,
+			"Tree[Func[] Block[Return]]",
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.Program, func(t *testing.T) {
@@ -94,3 +395,223 @@ func TestParserParse(t *testing.T) {
 		})
 	}
 }
+
+func TestParserPrecedence(t *testing.T) {
+	tests := []struct {
+		Program        string
+		ExpectedOutput string
+	}{
+		{"2 * 3 + 4", "Tree[Op{add}[Op{mul}[2 3] 4]]"},
+		{"2 + 3 * 4", "Tree[Op{add}[2 Op{mul}[3 4]]]"},
+		{"a - b - c", "Tree[Op{sub}[Op{sub}[@a @b] @c]]"},
+		{"a / b * c", "Tree[Op{mul}[Op{div}[@a @b] @c]]"},
+		{"a + b - c + d", "Tree[Op{add}[Op{sub}[Op{add}[@a @b] @c] @d]]"},
+		{"a < b == c >= d", "Tree[Op{eq}[Op{lt}[@a @b] Op{ge}[@c @d]]]"},
+		{"a + 1 < b * 2", "Tree[Op{lt}[Op{add}[@a 1] Op{mul}[@b 2]]]"},
+		{"a == b != c", "Tree[Op{ne}[Op{eq}[@a @b] @c]]"},
+		{"a or b and c", "Tree[Or[@a And[@b @c]]]"},
+		{"a and b or c", "Tree[Or[And[@a @b] @c]]"},
+		{"a and b and c", "Tree[And[And[@a @b] @c]]"},
+		{"a == 1 and b < 2", "Tree[And[Op{eq}[@a 1] Op{lt}[@b 2]]]"},
+		{"-a * b", "Tree[Op{mul}[Op{neg}[@a] @b]]"},
+		{"a * -b", "Tree[Op{mul}[@a Op{neg}[@b]]]"},
+		{"- -a", "Tree[Op{neg}[Op{neg}[@a]]]"},
+		{"!a and b", "Tree[And[Not[@a] @b]]"},
+		{"!a == b", "Tree[Op{eq}[Not[@a] @b]]"},
+		{"-(a + b) * c", "Tree[Op{mul}[Op{neg}[Tree[Op{add}[@a @b]]] @c]]"},
+		{"-xs[0]", "Tree[Op{neg}[Op{index}[@xs 0]]]"},
+		{"x = 1 + 2 * 3", "Tree[@x=Op{add}[1 Op{mul}[2 3]]]"},
+		{"a % b ~/ c * d", "Tree[Op{mul}[Op{floordiv}[Op{mod}[@a @b] @c] @d]]"},
+		{"a + b % c", "Tree[Op{add}[@a Op{mod}[@b @c]]]"},
+		{"a ** b ** c", "Tree[Op{pow}[@a Op{pow}[@b @c]]]"},
+		{"a * b ** c", "Tree[Op{mul}[@a Op{pow}[@b @c]]]"},
+		{"-a ** b", "Tree[Op{neg}[Op{pow}[@a @b]]]"},
+		{"a ** -b", "Tree[Op{pow}[@a Op{neg}[@b]]]"},
+		{"f(a + b, c * d)", "Tree[@f[Op{add}[@a @b] Op{mul}[@c @d]]]"},
+		{"a + b c - d", "Tree[Op{add}[@a @b] Op{sub}[@c @d]]"},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			ast, err := mini.NewParser(strings.NewReader(test.Program)).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			output := fmt.Sprint(ast)
+			if test.ExpectedOutput != output {
+				t.Errorf("expected %q, got %q", test.ExpectedOutput, output)
+			}
+		})
+	}
+}
+
+func TestParserSpans(t *testing.T) {
+	src := "x = 1 + foo(2)\nif x {\n  y.bar(\"a\")\n}"
+	expr, err := mini.NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := expr.(*mini.Tree)
+	assign := tree.Exprs[0].(*mini.AssignExpr)
+	sum := assign.Expr.(*mini.OpExpr)
+	call := sum.Args[0].(*mini.CallExpr)
+	ifExpr := tree.Exprs[1].(*mini.IfExpr)
+	block := ifExpr.If.Block.(*mini.Block)
+	method := block.Exprs[0].(*mini.CallExpr)
+	tests := []struct {
+		Name     string
+		Expr     mini.Expression
+		Expected string
+	}{
+		{"tree", tree, "1:1-4:2"},
+		{"assign", assign, "1:1-1:15"},
+		{"sum", sum, "1:5-1:15"},
+		{"literal", sum.Base, "1:5-1:6"},
+		{"call", call, "1:9-1:15"},
+		{"ident", call.Func, "1:9-1:12"},
+		{"if", ifExpr, "2:1-4:2"},
+		{"condition", ifExpr.If.Condition, "2:4-2:5"},
+		{"block", block, "2:6-4:2"},
+		{"method call", method, "3:3-3:13"},
+		{"selector", method.Func, "3:3-3:8"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			span := mini.SpanOf(test.Expr)
+			if s := fmt.Sprint(span.Start, "-", span.End); s != test.Expected {
+				t.Errorf("expected %s, got %s", test.Expected, s)
+			}
+		})
+	}
+}
+
+func TestParserErrorPosition(t *testing.T) {
+	tests := []struct {
+		Program  string
+		Expected string
+	}{
+		{"{1 2}", "Expected : at 1:4"},
+		{"f(1", "Unexpected end of input at 1:4"},
+		{"x = ", "Expected expression at 1:5"},
+		{"1 +\n  )", "Expected expression at 2:3"},
+		{"func(a { }", "Expected parameter name at 1:8"},
+		{"func() 1", "Expected block at 1:8"},
+		{"try { 1 }", "Expected catch or finally after try block at 1:10"},
+		{"xs[1", "Expected ] at 1:5"},
+		{"x.(", "Expected method name at 1:3"},
+		{"f(1,,2)", "Expected expression at 1:5"},
+		{"[1, , 2]", "Expected expression at 1:5"},
+		{"7 // 2", "// begins a comment, not a floor division at 1:3"},
+		{"x = f(a)[0]  //(b + 1)", "// begins a comment, not a floor division at 1:14"},
+		{"12q", "Unknown number suffix \"q\" at 1:1"},
+		{"x = 1e3", "exponents are not supported in number literals at 1:6"},
+		{"1.5e2", "exponents are not supported in number literals at 1:4"},
+		{"1e3n", "exponents are not supported in number literals at 1:2"},
+		{"1.5e-2d", "exponents are not supported in number literals at 1:4"},
+		{"1.2.3", "Malformed number literal \"1.2.3\" at 1:1"},
+		{"1.5n", "Expected an integer before the n suffix: \"1.5n\" at 1:1"},
+		{"99999999999999999999", "Integer literal 99999999999999999999 is out of range at 1:1"},
+		{"break", "Unexpected break outside of a loop at 1:1"},
+		{"\n  \"abc", "unterminated string literal at 2:3"},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			_, err := mini.NewFileParser("test.mini", strings.NewReader(test.Program)).Parse()
+			e, ok := err.(*mini.Error)
+			if !ok {
+				t.Fatalf("expected a *mini.Error, got %v", err)
+			}
+			if e.Kind != mini.ErrorSyntax || e.File != "test.mini" {
+				t.Errorf("expected a SyntaxError in test.mini, got %v in %q", e.Kind, e.File)
+			}
+			if msg := fmt.Sprint(e.Msg, " at ", e.Pos); msg != test.Expected {
+				t.Errorf("expected %q, got %q", test.Expected, msg)
+			}
+		})
+	}
+}
+
+func TestParserRecovery(t *testing.T) {
+	tests := []struct {
+		Program     string
+		Expected    string
+		Diagnostics []string
+	}{
+		{
+			"x = 1",
+			"Tree[@x=1]",
+			nil,
+		},
+		{
+			"{1 2}\nok()",
+			"Tree[@ok[]]",
+			[]string{"1:4: SyntaxError: Expected :"},
+		},
+		{
+			"if x { a = }\nb = 2",
+			"Tree[If(Cond(@x=>Block[]) Cond(<nil>=><nil>)) @b=2]",
+			[]string{"1:12: SyntaxError: Expected expression"},
+		},
+		{
+			"x = $ + 1\ny = )\nz = 3",
+			"Tree[@z=3]",
+			[]string{
+				"1:5: SyntaxError: Unexpected \"$\"",
+				"2:5: SyntaxError: Expected expression",
+			},
+		},
+		{
+			"1 )",
+			"Tree[1]",
+			[]string{"1:3: SyntaxError: Unexpected \")\""},
+		},
+		{
+			"}\na",
+			"Tree[@a]",
+			[]string{"1:1: SyntaxError: Unexpected \"}\""},
+		},
+		{
+			"if x { 1",
+			"Tree[If(Cond(@x=>Block[1]) Cond(<nil>=><nil>))]",
+			[]string{"1:9: SyntaxError: Unexpected end of input"},
+		},
+		{
+			"if a { if b { 1",
+			"Tree[If(Cond(@a=>Block[If(Cond(@b=>Block[1]) Cond(<nil>=><nil>))]) Cond(<nil>=><nil>))]",
+			[]string{"1:16: SyntaxError: Unexpected end of input"},
+		},
+		{
+			"f = func() {\n  g(1 2\n  h()\n}\nf()",
+			"Tree[@f=Func[] Block[] @f[]]",
+			[]string{"4:1: SyntaxError: Unexpected \"}\""},
+		},
+		{
+			"x = 7 // seven\n// 2 is next\ny = [\n  1, // one\n]",
+			"Tree[@x=7 @y=List[1]]",
+			nil,
+		},
+		{
+			"f(1,,2)\nx = 1",
+			"Tree[@x=1]",
+			[]string{"1:5: SyntaxError: Expected expression"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			p := mini.NewParser(strings.NewReader(test.Program))
+			expr, err := p.Parse()
+			if s := fmt.Sprint(expr); s != test.Expected {
+				t.Errorf("expected %s, got %s", test.Expected, s)
+			}
+			var diags []string
+			for _, d := range p.Diagnostics() {
+				diags = append(diags, d.String())
+			}
+			if !reflect.DeepEqual(diags, test.Diagnostics) {
+				t.Errorf("expected %q, got %q", test.Diagnostics, diags)
+			}
+			if (err != nil) != (len(test.Diagnostics) > 0) {
+				t.Errorf("expected the first diagnostic as the error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package mini
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// indent is the indentation of each level of nested blocks
+const indent = "    "
+
+// precPrimary is the precedence of expressions which never need parentheses
+// as an operand
+const precPrimary = precPower + 1
+
+// binaryOps are the spelling and precedence of the binary operators
+var binaryOps = map[Op]struct {
+	text string
+	prec int
+}{
+	OpAdd:      {"+", precAdditive},
+	OpSub:      {"-", precAdditive},
+	OpMul:      {"*", precMultiplicative},
+	OpDiv:      {"/", precMultiplicative},
+	OpMod:      {"%", precMultiplicative},
+	OpFloorDiv: {"~/", precMultiplicative},
+	OpPow:      {"**", precPower},
+	OpLt:       {"<", precComparison},
+	OpLe:       {"<=", precComparison},
+	OpGt:       {">", precComparison},
+	OpGe:       {">=", precComparison},
+	OpEq:       {"==", precEquality},
+	OpNe:       {"!=", precEquality},
+}
+
+// Format returns mini source for expr in canonical form, which parses back
+// to an equivalent AST. A Tree at the root is formatted as a sequence of
+// statements, one per line. Parentheses are added where the AST could not
+// otherwise be written, so the AST parsed back may have a Tree in their
+// place.
+func Format(expr Expression) (string, error) {
+	p := &printer{}
+	if tree, ok := expr.(*Tree); ok {
+		p.statements(tree.Exprs)
+	} else {
+		p.statements([]Expression{expr})
+	}
+	return p.buf.String(), p.err
+}
+
+// Fprint writes the source for expr to w, see Format
+func Fprint(w io.Writer, expr Expression) error {
+	src, err := Format(expr)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, src)
+	return err
+}
+
+type printer struct {
+	buf   bytes.Buffer
+	depth int
+	err   error
+}
+
+func (p *printer) errorf(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (p *printer) print(args ...string) {
+	for _, s := range args {
+		p.buf.WriteString(s)
+	}
+}
+
+// statements prints each of exprs on a line of its own at the current depth
+func (p *printer) statements(exprs []Expression) {
+	for i, expr := range exprs {
+		p.print(strings.Repeat(indent, p.depth))
+		start := p.buf.Len()
+		p.expr(expr)
+		if i > 0 && bytes.HasPrefix(p.buf.Bytes()[start:], []byte("-")) {
+			// a statement beginning with a minus would continue the
+			// statement before it, so it is parenthesized
+			p.buf.Truncate(start)
+			p.parenthesized(expr)
+		}
+		p.print("\n")
+	}
+}
+
+// block prints a block, which is braced and indented
+func (p *printer) block(expr Expression) {
+	b, ok := expr.(*Block)
+	if !ok {
+		p.errorf("cannot format %T as a block", expr)
+		return
+	}
+	if len(b.Exprs) == 0 {
+		p.print("{}")
+		return
+	}
+	p.print("{\n")
+	p.depth++
+	p.statements(b.Exprs)
+	p.depth--
+	p.print(strings.Repeat(indent, p.depth), "}")
+}
+
+// list prints exprs separated by commas
+func (p *printer) list(exprs []Expression) {
+	for i, expr := range exprs {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.expr(expr)
+	}
+}
+
+func (p *printer) parenthesized(expr Expression) {
+	p.print("(")
+	p.expr(expr)
+	p.print(")")
+}
+
+// operand prints expr as an operand of an operator with precedence prec,
+// parenthesizing it if it binds more loosely
+func (p *printer) operand(expr Expression, prec int, left bool) {
+	var paren bool
+	switch own := precedence(expr); {
+	case own == precUnary:
+		// a unary operator binds its operand as tightly as it can, so it
+		// only needs parentheses as the base of a power
+		paren = left && prec > precUnary
+	case left:
+		paren = own < prec || own == prec && prec == precPower
+	default:
+		paren = own < prec || own == prec && prec != precPower
+	}
+	if paren {
+		p.parenthesized(expr)
+	} else {
+		p.expr(expr)
+	}
+}
+
+// base prints expr as the base of a call, index or selector, parenthesizing
+// it unless it is a primary expression
+func (p *printer) base(expr Expression) {
+	switch e := expr.(type) {
+	case *Ident, *Tree, *ListExpr, *MapExpr, *CallExpr, *SelectorExpr, Symbol:
+		p.expr(expr)
+		return
+	case *Literal:
+		if precedence(e) == precPrimary {
+			p.expr(expr)
+			return
+		}
+	case *OpExpr:
+		if e.Op == OpIndex {
+			p.expr(expr)
+			return
+		}
+	}
+	p.parenthesized(expr)
+}
+
+// condition prints the condition before a block, which is omitted if it is
+// the implicit TRUE
+func (p *printer) condition(expr Expression) {
+	if expr == TRUE {
+		return
+	}
+	start := p.buf.Len()
+	p.expr(expr)
+	_, assign := expr.(*AssignExpr)
+	if assign || bytes.HasPrefix(p.buf.Bytes()[start:], []byte("{")) {
+		// the condition would be rejected or taken for the block
+		p.buf.Truncate(start)
+		p.parenthesized(expr)
+	}
+	p.print(" ")
+}
+
+func (p *printer) conditional(keyword string, cb ConditionalBlock) {
+	p.print(keyword, " ")
+	p.condition(cb.Condition)
+	p.block(cb.Block)
+}
+
+// precedence returns the precedence of expr as an operand
+func precedence(expr Expression) int {
+	switch e := expr.(type) {
+	case *AssignExpr, *ReturnExpr:
+		// these extend as far to the right as they can
+		return precLowest
+	case *OpExpr:
+		if e.Op == OpSetIndex {
+			return precLowest
+		}
+		if e.Op == OpNeg {
+			return precUnary
+		}
+		if op, ok := binaryOps[e.Op]; ok && len(e.Args) == 1 {
+			return op.prec
+		}
+	case *NotExpr:
+		return precUnary
+	case *AndExpr:
+		return precAnd
+	case *OrExpr:
+		return precOr
+	case *Literal:
+		return valuePrecedence(e.Value)
+	case Object:
+		return valuePrecedence(e)
+	}
+	return precPrimary
+}
+
+// valuePrecedence returns the precedence of a literal value, which is that
+// of a unary minus if it is negative
+func valuePrecedence(obj Object) int {
+	var negative bool
+	switch o := obj.(type) {
+	case Int:
+		negative = o < 0
+	case Number:
+		negative = math.Signbit(float64(o))
+	case BigInt:
+		negative = o.val.Sign() < 0
+	case Decimal:
+		negative = o.val.Sign() < 0
+	}
+	if negative {
+		return precUnary
+	}
+	return precPrimary
+}
+
+func (p *printer) expr(expr Expression) {
+	switch e := expr.(type) {
+	case *Tree:
+		p.print("(")
+		p.list(e.Exprs)
+		p.print(")")
+	case *Block:
+		p.block(e)
+	case *IfExpr:
+		p.conditional("if", e.If)
+		if e.Else.Block != nil {
+			p.print(" ")
+			p.conditional("else", e.Else)
+		}
+	case *ForExpr:
+		if e.Label != "" {
+			p.print(e.Label, ": ")
+		}
+		p.conditional("for", e.For)
+	case *ForInExpr:
+		if e.Label != "" {
+			p.print(e.Label, ": ")
+		}
+		p.print("for ")
+		if e.Key != "" {
+			p.print(string(e.Key), ", ")
+		}
+		p.print(string(e.Value), " in ")
+		p.expr(e.Iter)
+		p.print(" ")
+		p.block(e.Body)
+	case *TryExpr:
+		p.print("try ")
+		p.block(e.Body)
+		if e.Catch != nil {
+			p.print(" catch ")
+			if e.Name != "" {
+				p.print(string(e.Name), " ")
+			}
+			p.block(e.Catch)
+		}
+		if e.Finally != nil {
+			p.print(" finally ")
+			p.block(e.Finally)
+		}
+	case *BreakExpr:
+		p.print("break")
+		if e.Label != "" {
+			p.print(" ", e.Label)
+		}
+	case *ContinueExpr:
+		p.print("continue")
+		if e.Label != "" {
+			p.print(" ", e.Label)
+		}
+	case *AssignExpr:
+		p.print(string(e.Name), " = ")
+		p.expr(e.Expr)
+	case *CallExpr:
+		p.base(e.Func)
+		p.print("(")
+		p.list(e.Args)
+		p.print(")")
+	case *SelectorExpr:
+		p.base(e.Base)
+		p.print(".", e.Name)
+	case *FuncExpr:
+		params := make([]string, len(e.Params))
+		for i, param := range e.Params {
+			params[i] = string(param)
+		}
+		p.print("func(", strings.Join(params, ", "), ") ")
+		p.block(e.Body)
+	case *ReturnExpr:
+		p.print("return")
+		if e.Expr != nil {
+			p.print(" ")
+			p.expr(e.Expr)
+		}
+	case *ListExpr:
+		p.print("[")
+		p.list(e.Items)
+		p.print("]")
+	case *MapExpr:
+		p.print("{")
+		for i, key := range e.Keys {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.expr(key)
+			p.print(": ")
+			p.expr(e.Values[i])
+		}
+		p.print("}")
+	case *Ident:
+		p.print(string(e.Name))
+	case Symbol:
+		p.print(string(e))
+	case *Literal:
+		p.value(e.Value)
+	case *NotExpr:
+		p.print("!")
+		p.unaryOperand(e.Expr)
+	case *AndExpr:
+		p.binary(e.LHS, "and", e.RHS, precAnd)
+	case *OrExpr:
+		p.binary(e.LHS, "or", e.RHS, precOr)
+	case *OpExpr:
+		p.op(e)
+	case Object:
+		p.value(e)
+	default:
+		p.errorf("cannot format %T", expr)
+	}
+}
+
+func (p *printer) binary(lhs Expression, op string, rhs Expression, prec int) {
+	p.operand(lhs, prec, true)
+	p.print(" ", op, " ")
+	p.operand(rhs, prec, false)
+}
+
+// unaryOperand prints the operand of a unary operator, which takes only
+// powers and other unary expressions without parentheses
+func (p *printer) unaryOperand(expr Expression) {
+	if precedence(expr) >= precUnary {
+		p.expr(expr)
+	} else {
+		p.parenthesized(expr)
+	}
+}
+
+func (p *printer) op(e *OpExpr) {
+	switch {
+	case e.Op == OpNeg && len(e.Args) == 0:
+		p.print("-")
+		p.unaryOperand(e.Base)
+	case e.Op == OpIndex && len(e.Args) == 1:
+		p.base(e.Base)
+		p.print("[")
+		p.expr(e.Args[0])
+		p.print("]")
+	case e.Op == OpSetIndex && len(e.Args) == 2:
+		p.base(e.Base)
+		p.print("[")
+		p.expr(e.Args[0])
+		p.print("] = ")
+		p.expr(e.Args[1])
+	default:
+		op, ok := binaryOps[e.Op]
+		if !ok || len(e.Args) != 1 {
+			p.errorf("cannot format the operation %v with %d arguments", e.Op, len(e.Args))
+			return
+		}
+		p.binary(e.Base, op.text, e.Args[0], op.prec)
+	}
+}
+
+// value prints a literal value
+func (p *printer) value(obj Object) {
+	switch o := obj.(type) {
+	case Bool:
+		p.print(strconv.FormatBool(bool(o)))
+	case Int:
+		if o == math.MinInt64 {
+			// the magnitude does not fit in an Int
+			p.print("(-9223372036854775807 - 1)")
+			return
+		}
+		p.print(strconv.FormatInt(int64(o), 10))
+	case Number:
+		f := float64(o)
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			p.print(`float("`, strconv.FormatFloat(f, 'g', -1, 64), `")`)
+			return
+		}
+		s := strconv.FormatFloat(f, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		p.print(s)
+	case BigInt:
+		p.print(o.val.String(), "n")
+	case Decimal:
+		scale, exact := decimalScale(o.val)
+		if !exact {
+			p.print("(", o.val.Num().String(), "d / ", o.val.Denom().String(), "d)")
+			return
+		}
+		p.print(o.val.FloatString(scale))
+		if scale == 0 {
+			// FloatString omits the point for integers
+			p.print(".0")
+		}
+		p.print("d")
+	case String:
+		p.print(quote(string(o)))
+	default:
+		p.errorf("cannot format a literal %T", obj)
+	}
+}
+
+// quote returns s as a string literal, using only the escape sequences the
+// scanner understands
+func quote(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&buf, `\x%02x`, s[i])
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\x%02x`, r)
+		default:
+			buf.WriteRune(r)
+		}
+		i += size
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
@@ -0,0 +1,229 @@
+package mini_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jncornett/mini"
+)
+
+// roundTripPrograms exercise the parts of the grammar which the evaluation
+// tests do not
+var roundTripPrograms = []string{
+	"x = -2 ** 2\ny = (-2) ** 2\nz = 2 ** -3 * 4",
+	"a = 1 - (2 - 3) - 4 ~/ 5 % 6",
+	"b = !(a and b) or !c and d",
+	"x == 1 != (y < 2) <= 3 >= 4 > 5",
+	"s = \"a\\\"b\\\\c\\n\\t\\r\\x01\\u00e9é\"",
+	"r = `raw\\n`",
+	"m = {\"k\": [1, 2.5, 3n, 1.50d, .5], 2: {}}",
+	"f = func(a, b) { return a + b }\nf(1, 2).string()",
+	"xs[0] = xs[1][2]\nys = xs[-1]",
+	"outer: for i in range(3) { for { if i == 1 { break outer } else { continue outer } } }",
+	"try { raise(\"x\") } catch e { print(e.message()) } finally { done() }",
+	"try { 1 } catch { 2 }",
+	"for k, v in m { }\nfor x in [] { }\nfor x < 10 { x = x + 1 }",
+	"if { 1 }\nif true { 2 } else { 3 }",
+	"(1, 2)\n(1,)\nf(1, 2,)\n()",
+	"1 .abs()\n1.5.abs()\n\"a\".upper()\n[1].len()\n{}.len()",
+	"f = func() { return }\ng = func() { return 1 + 2 }",
+	"x = y = z = 1",
+	"if (x = 1) { x }",
+	"a.b.c(d)(e)[f].g",
+	"x = if a { 1 } else { 2 } + 3",
+	"-(-x)\n!!x\n- -x",
+	"x = 1\n(-x)",
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	programs := append([]string(nil), roundTripPrograms...)
+	for _, test := range evalTests {
+		programs = append(programs, test.Program)
+	}
+	examples, _ := filepath.Glob("examples/*.mini")
+	for _, path := range examples {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		programs = append(programs, string(src))
+	}
+	for _, program := range programs {
+		expr, err := mini.NewParser(strings.NewReader(program)).Parse()
+		if err != nil {
+			// some evaluation tests expect syntax errors
+			continue
+		}
+		t.Run(program, func(t *testing.T) {
+			src, err := mini.Format(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reparsed, err := mini.NewParser(strings.NewReader(src)).Parse()
+			if err != nil {
+				t.Fatalf("%v in\n%s", err, src)
+			}
+			again, err := mini.Format(reparsed)
+			if err != nil || again != src {
+				t.Errorf("expected formatting to be stable, got\n%s\nthen\n%s", src, again)
+			}
+			mini.Walk(expr, positionClearer{})
+			mini.Walk(reparsed, positionClearer{})
+			if !reflect.DeepEqual(reparsed, expr) {
+				t.Errorf("expected %v, got %v from\n%s", expr, reparsed, src)
+			}
+		})
+	}
+}
+
+// positionClearer zeroes the spans and positions of the nodes it visits, so
+// that ASTs parsed from differently laid out source compare equal
+type positionClearer struct{}
+
+var (
+	spanType     = reflect.TypeOf(mini.Span{})
+	positionType = reflect.TypeOf(mini.Position{})
+)
+
+func (c positionClearer) Visit(expr mini.Expression) mini.Visitor {
+	if v := reflect.ValueOf(expr); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+		clearPositions(v.Elem())
+	}
+	return c
+}
+
+func clearPositions(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		switch f := v.Field(i); {
+		case !f.CanSet():
+		case f.Type() == spanType || f.Type() == positionType:
+			f.Set(reflect.Zero(f.Type()))
+		case f.Kind() == reflect.Struct:
+			clearPositions(f)
+		}
+	}
+}
+
+func TestFormatEval(t *testing.T) {
+	for _, test := range evalTests {
+		if test.ExpectError || strings.Contains(test.Program, "line()") {
+			// formatting moves the positions errors report
+			continue
+		}
+		t.Run(test.Program, func(t *testing.T) {
+			src, err := mini.Format(parse(t, test.Program))
+			if err != nil {
+				t.Fatal(err)
+			}
+			vm := mini.NewVm()
+			if err := vm.EvalString(src); err != nil {
+				t.Fatalf("%v in\n%s", err, src)
+			}
+			if result := fmt.Sprint(vm.Result); result != test.ExpectedResult {
+				t.Errorf("expected %q, got %q from\n%s", test.ExpectedResult, result, src)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		Program  string
+		Expected string
+	}{
+		{"x=1+2", "x = 1 + 2\n"},
+		{"print(a b)", "print(a, b)\n"},
+		{"f = func(x) { if x { 1 } else { } }", "f = func(x) {\n    if x {\n        1\n    } else {}\n}\n"},
+		{"1.50  // one and a half", "1.5\n"},
+		{"try{a}catch e{b}", "try {\n    a\n} catch e {\n    b\n}\n"},
+		{"{1:2,3:4}", "{1: 2, 3: 4}\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			src, err := mini.Format(parse(t, test.Program))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src != test.Expected {
+				t.Errorf("expected %q, got %q", test.Expected, src)
+			}
+		})
+	}
+}
+
+func TestFormatSynthetic(t *testing.T) {
+	ident := func(name string) mini.Expression { return &mini.Ident{Name: mini.Symbol(name)} }
+	lit := func(obj mini.Object) mini.Expression { return &mini.Literal{Value: obj} }
+	op := func(o mini.Op, base mini.Expression, args ...mini.Expression) mini.Expression {
+		return &mini.OpExpr{Op: o, Base: base, Args: args}
+	}
+	a, b, c := ident("a"), ident("b"), ident("c")
+	block := &mini.Block{Exprs: []mini.Expression{a}}
+	tests := []struct {
+		Expr     mini.Expression
+		Expected string
+	}{
+		{op(mini.OpMul, op(mini.OpAdd, a, b), c), "(a + b) * c"},
+		{op(mini.OpSub, a, op(mini.OpSub, b, c)), "a - (b - c)"},
+		{op(mini.OpPow, op(mini.OpPow, a, b), c), "(a ** b) ** c"},
+		{op(mini.OpPow, a, op(mini.OpPow, b, c)), "a ** b ** c"},
+		{op(mini.OpPow, op(mini.OpNeg, a), b), "(-a) ** b"},
+		{op(mini.OpNeg, op(mini.OpAdd, a, b)), "-(a + b)"},
+		{&mini.NotExpr{Expr: &mini.AndExpr{LHS: a, RHS: b}}, "!(a and b)"},
+		{&mini.AndExpr{LHS: &mini.OrExpr{LHS: a, RHS: b}, RHS: c}, "(a or b) and c"},
+		{op(mini.OpAdd, &mini.AssignExpr{Name: "x", Expr: a}, b), "(x = a) + b"},
+		{&mini.SelectorExpr{Base: lit(mini.Int(-3)), Name: "abs"}, "(-3).abs"},
+		{op(mini.OpPow, lit(mini.Int(-3)), lit(mini.Int(2))), "(-3) ** 2"},
+		{&mini.CallExpr{Func: &mini.FuncExpr{Body: block}}, "(func() {\n    a\n})()"},
+		{op(mini.OpIndex, op(mini.OpAdd, a, b), c), "(a + b)[c]"},
+		{&mini.Tree{Exprs: []mini.Expression{a, op(mini.OpNeg, b)}}, "a\n(-b)"},
+		{&mini.IfExpr{If: mini.ConditionalBlock{Condition: &mini.MapExpr{}, Block: block}}, "if ({}) {\n    a\n}"},
+		{&mini.ForExpr{For: mini.ConditionalBlock{Condition: mini.TRUE, Block: block}}, "for {\n    a\n}"},
+		{mini.Int(math.MinInt64), "(-9223372036854775807 - 1)"},
+		{mini.Number(1), "1.0"},
+		{mini.Number(-0.25), "-0.25"},
+		{mini.Number(math.Inf(1)), "float(\"+Inf\")"},
+		{mini.NewDecimal(big.NewRat(1, 3)), "(1d / 3d)"},
+		{mini.NewDecimal(big.NewRat(5, 1)), "5.0d"},
+		{mini.String("\xff\x00"), "\"\\xff\\x00\""},
+		{mini.FALSE, "false"},
+	}
+	for _, test := range tests {
+		t.Run(test.Expected, func(t *testing.T) {
+			src, err := mini.Format(test.Expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if src != test.Expected+"\n" {
+				t.Errorf("expected %q, got %q", test.Expected+"\n", src)
+			}
+			if _, err := mini.NewParser(strings.NewReader(src)).Parse(); err != nil {
+				t.Errorf("expected the source to parse, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	tests := []mini.Expression{
+		&mini.Literal{Value: mini.NewList()},
+		&mini.OpExpr{Op: mini.OpAdd, Base: &mini.Ident{Name: "a"}},
+		&mini.IfExpr{If: mini.ConditionalBlock{Condition: mini.TRUE, Block: &mini.Ident{Name: "a"}}},
+		&mini.CallExpr{Func: &mini.Ident{Name: "f"}, Args: []mini.Expression{mini.Int(1), nil}},
+		&mini.Tree{Exprs: []mini.Expression{nil}},
+		&mini.ListExpr{Items: []mini.Expression{nil, mini.Int(1)}},
+	}
+	for _, expr := range tests {
+		t.Run(fmt.Sprint(expr), func(t *testing.T) {
+			if _, err := mini.Format(expr); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package mini
+
+import (
+	"context"
+	"strings"
+)
+
+// Program is a parsed and compiled script. A Program is immutable, so it may
+// be run any number of times, concurrently, against different Vms.
+type Program struct {
+	expr  Expression
+	proto *funcProto
+	file  string
+}
+
+// Compile parses and compiles src
+func Compile(src string) (*Program, error) {
+	return CompileFile("", src)
+}
+
+// CompileFile is like Compile, but errors refer to the source as file
+func CompileFile(file, src string) (*Program, error) {
+	expr, err := NewFileParser(file, strings.NewReader(src)).Parse()
+	if err != nil {
+		return nil, err
+	}
+	proto, err := compile(expr, file)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{expr: expr, proto: proto, file: file}, nil
+}
+
+// Run evaluates p in vm and returns the result, see Vm.EvalProgram
+func (p *Program) Run(vm *Vm) (Object, error) {
+	err := vm.EvalProgram(p)
+	return vm.Result, err
+}
+
+// RunContext is like Run, but stops with a CanceledError once ctx is done
+func (p *Program) RunContext(ctx context.Context, vm *Vm) (Object, error) {
+	err := vm.EvalProgramContext(ctx, p)
+	return vm.Result, err
+}
@@ -0,0 +1,99 @@
+package mini
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Range is a lazy arithmetic sequence of Ints, from Start up to but not
+// including Stop, in increments of Step
+type Range struct {
+	Start, Stop, Step int64
+}
+
+// NewRange constructs a Range. Step must not be zero.
+func NewRange(start, stop, step int64) (*Range, error) {
+	if step == 0 {
+		return nil, errors.New("ValueError: range step must not be zero")
+	}
+	return &Range{Start: start, Stop: stop, Step: step}, nil
+}
+
+// Truthy helps Range implement the Object interface
+func (o *Range) Truthy() bool { return o.Len() != 0 }
+
+// IsNil helps Range implement the Object interface
+func (o *Range) IsNil() bool { return false }
+
+// Send helps Range implement the Object interface
+func (o *Range) Send(op Op, args Args) (Object, error) {
+	switch op {
+	case OpEq, OpNe:
+		rhs, ok := args.Arg(0).(*Range)
+		eq := ok && *o == *rhs
+		return Bool(eq == (op == OpEq)), nil
+	}
+	return nil, NewErrInvalidOp(op, o)
+}
+
+// Eval helps Range implement the Expression interface
+func (o *Range) Eval(*Vm) (Object, error) { return o, nil }
+
+// Len returns the number of Ints in the range
+func (o *Range) Len() int64 {
+	// the distances are computed unsigned so that they cannot overflow
+	switch {
+	case o.Step > 0 && o.Start < o.Stop:
+		return int64((uint64(o.Stop)-uint64(o.Start)-1)/uint64(o.Step) + 1)
+	case o.Step < 0 && o.Start > o.Stop:
+		return int64((uint64(o.Start)-uint64(o.Stop)-1)/(-uint64(o.Step)) + 1)
+	}
+	return 0
+}
+
+// Iterate helps Range implement the Iterable interface. It yields the index
+// and value of each Int.
+func (o *Range) Iterate() Iterator {
+	return &rangeIterator{r: o, n: o.Len(), pos: -1}
+}
+
+func (o *Range) String() string {
+	return fmt.Sprintf("range(%d, %d, %d)", o.Start, o.Stop, o.Step)
+}
+
+type rangeIterator struct {
+	r   *Range
+	n   int64
+	pos int64
+}
+
+func (it *rangeIterator) Next() bool {
+	if it.pos < it.n {
+		it.pos++
+	}
+	return it.pos < it.n
+}
+
+func (it *rangeIterator) Key() Object { return Int(it.pos) }
+
+func (it *rangeIterator) Value() Object { return Int(it.r.Start + it.pos*it.r.Step) }
+
+// newRangeBuiltin implements range(stop), range(start, stop) and
+// range(start, stop, step)
+func newRangeBuiltin(args Args) (Object, error) {
+	if args.Len() < 1 || args.Len() > 3 {
+		return nil, fmt.Errorf("TypeError: range expects 1 to 3 arguments, got %d", args.Len())
+	}
+	bounds := []int64{0, 0, 1}
+	for i, arg := range args {
+		n, ok := arg.(Int)
+		if !ok {
+			return nil, newTypeError(i, intType, arg)
+		}
+		bounds[i] = int64(n)
+	}
+	if args.Len() == 1 {
+		bounds[0], bounds[1] = 0, bounds[0]
+	}
+	return NewRange(bounds[0], bounds[1], bounds[2])
+}
@@ -3,7 +3,9 @@ package mini
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
+	"unicode/utf8"
 )
 
 const eofChar = rune(0)
@@ -15,6 +17,10 @@ type Position struct {
 	Col int
 }
 
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Row+1, p.Col+1)
+}
+
 type Token struct {
 	Type  TokenType
 	Value string
@@ -27,6 +33,7 @@ const (
 	ILLEGAL TokenType = iota
 	EOF
 	WS
+	COMMENT
 
 	// Literals
 	STRING
@@ -42,11 +49,16 @@ const (
 	SQUAREOPEN
 	SQUARECLOSE
 	COMMA
+	COLON
+	DOT
 	ASSIGN
 	ADD
 	SUBTRACT
 	MULTIPLY
 	DIVIDE
+	MODULO
+	POWER
+	FLOORDIVIDE
 	NOT
 	LESS
 	GREATER
@@ -59,23 +71,47 @@ const (
 	IF
 	ELSE
 	FOR
-	BREAK    // FIXME implement break
-	CONTINUE // FIXME implement continue
+	BREAK
+	CONTINUE
 	AND
 	OR
+	FUNC
+	RETURN
+	IN
+	TRY
+	CATCH
+	FINALLY
 )
 
+// ScanError describes why the scanner produced an ILLEGAL token
+type ScanError struct {
+	Pos Position
+	Msg string
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
+
 type Scanner struct {
 	r       *bufio.Reader
 	pos     Position
 	lastPos Position
+	err     error
 }
 
 func NewScanner(r io.Reader) *Scanner {
 	return &Scanner{r: bufio.NewReader(r)}
 }
 
+// Err returns the reason the most recently scanned token is ILLEGAL, or nil
+// if there is no specific reason
+func (s *Scanner) Err() error {
+	return s.err
+}
+
 func (s *Scanner) Scan() Token {
+	s.err = nil
 	start := s.pos
 	ch := s.readRune()
 
@@ -83,10 +119,12 @@ func (s *Scanner) Scan() Token {
 		return s.scanWhitespace(ch, start)
 	} else if isLetter(ch) || ch == '_' {
 		return s.scanIdent(ch, start)
-	} else if isNumber(ch) || ch == '.' {
+	} else if isNumber(ch) || ch == '.' && isNumber(s.peekRune(0)) {
 		return s.scanNumberLiteral(ch, start)
 	} else if ch == '"' {
 		return s.scanStringLiteral(start)
+	} else if ch == '`' {
+		return s.scanRawStringLiteral(start)
 	} else if ch == eofChar {
 		return Token{EOF, "", start, s.pos}
 	}
@@ -108,13 +146,40 @@ func (s *Scanner) Scan() Token {
 		tt = SQUARECLOSE
 	case ',':
 		tt = COMMA
+	case ':':
+		tt = COLON
+	case '.':
+		tt = DOT
 	case '+':
 		tt = ADD
 	case '-':
 		tt = SUBTRACT
 	case '*':
-		tt = MULTIPLY
+		if s.readRune() == '*' {
+			val += "*"
+			tt = POWER
+		} else {
+			s.unreadRune()
+			tt = MULTIPLY
+		}
+	case '%':
+		tt = MODULO
+	case '~':
+		// "//" begins a comment, so floor division is spelled "~/"
+		if s.readRune() == '/' {
+			val += "/"
+			tt = FLOORDIVIDE
+		} else {
+			s.unreadRune()
+		}
 	case '/':
+		switch s.readRune() {
+		case '/':
+			return s.scanLineComment(start)
+		case '*':
+			return s.scanBlockComment(start)
+		}
+		s.unreadRune()
 		tt = DIVIDE
 	case '=':
 		if s.readRune() == '=' {
@@ -155,10 +220,11 @@ func (s *Scanner) Scan() Token {
 
 func (s *Scanner) readRune() rune {
 	ch, _, err := s.r.ReadRune()
+	s.lastPos = s.pos
 	if err != nil {
-		ch = eofChar
+		// the end of input stays where it is
+		return eofChar
 	}
-	s.lastPos = s.pos
 	if ch == '\n' {
 		s.pos.Row++
 		s.pos.Col = 0
@@ -168,6 +234,19 @@ func (s *Scanner) readRune() rune {
 	return ch
 }
 
+// peekRune returns the ASCII character n bytes ahead without consuming it.
+// Multibyte characters are reported as utf8.RuneError.
+func (s *Scanner) peekRune(n int) rune {
+	b, _ := s.r.Peek(n + 1)
+	if len(b) <= n {
+		return eofChar
+	}
+	if b[n] >= utf8.RuneSelf {
+		return utf8.RuneError
+	}
+	return rune(b[n])
+}
+
 func (s *Scanner) unreadRune() {
 	_ = s.r.UnreadRune()
 	s.pos = s.lastPos
@@ -189,6 +268,41 @@ func (s *Scanner) scanWhitespace(first rune, start Position) Token {
 	return Token{WS, buf.String(), start, s.pos}
 }
 
+func (s *Scanner) scanLineComment(start Position) Token {
+	var buf bytes.Buffer
+	buf.WriteString("//")
+	for {
+		ch := s.readRune()
+		if ch == '\n' || ch == eofChar {
+			s.unreadRune()
+			break
+		}
+		buf.WriteRune(ch)
+	}
+	return Token{COMMENT, buf.String(), start, s.pos}
+}
+
+func (s *Scanner) scanBlockComment(start Position) Token {
+	var buf bytes.Buffer
+	buf.WriteString("/*")
+	for {
+		ch := s.readRune()
+		if ch == eofChar {
+			s.setErr(start, "unterminated block comment")
+			return Token{ILLEGAL, buf.String(), start, s.pos}
+		}
+		buf.WriteRune(ch)
+		if ch == '*' {
+			if next := s.readRune(); next == '/' {
+				buf.WriteRune(next)
+				break
+			}
+			s.unreadRune()
+		}
+	}
+	return Token{COMMENT, buf.String(), start, s.pos}
+}
+
 func (s *Scanner) scanIdent(first rune, start Position) Token {
 	var buf bytes.Buffer
 	buf.WriteRune(first)
@@ -219,6 +333,18 @@ func (s *Scanner) scanIdent(first rune, start Position) Token {
 		tok = AND
 	case "or":
 		tok = OR
+	case "func":
+		tok = FUNC
+	case "return":
+		tok = RETURN
+	case "in":
+		tok = IN
+	case "try":
+		tok = TRY
+	case "catch":
+		tok = CATCH
+	case "finally":
+		tok = FINALLY
 	case "true", "false":
 		tok = BOOL
 	default:
@@ -228,38 +354,132 @@ func (s *Scanner) scanIdent(first rune, start Position) Token {
 }
 
 func (s *Scanner) scanStringLiteral(start Position) Token {
-	var buf bytes.Buffer
-	escape := false
+	var buf, raw bytes.Buffer
+	raw.WriteRune('"')
 	for {
 		ch := s.readRune()
 		if ch == eofChar {
+			s.setErr(start, "unterminated string literal")
+			return Token{ILLEGAL, raw.String(), start, s.pos}
+		}
+		raw.WriteRune(ch)
+		if ch == '"' {
 			break
-		} else if escape {
-			buf.WriteRune(ch)
-			escape = false
-			continue
 		} else if ch == '\\' {
-			escape = true
-		} else if ch == '"' {
-			break
+			s.scanEscape(&buf, &raw)
 		} else {
 			buf.WriteRune(ch)
 		}
 	}
+	if s.err != nil {
+		return Token{ILLEGAL, raw.String(), start, s.pos}
+	}
 	return Token{STRING, buf.String(), start, s.pos}
 }
 
+// scanEscape decodes the escape sequence following a backslash into buf. The
+// source text of the sequence is copied to raw.
+func (s *Scanner) scanEscape(buf, raw *bytes.Buffer) {
+	pos := s.lastPos
+	ch := s.readRune()
+	if ch == eofChar {
+		// let the caller report the unterminated literal
+		s.unreadRune()
+		return
+	}
+	raw.WriteRune(ch)
+	switch ch {
+	case 'n':
+		buf.WriteByte('\n')
+	case 't':
+		buf.WriteByte('\t')
+	case 'r':
+		buf.WriteByte('\r')
+	case '\\', '"':
+		buf.WriteRune(ch)
+	case 'x':
+		if v, ok := s.scanHexDigits(2, raw); ok {
+			buf.WriteByte(byte(v))
+		} else {
+			s.setErr(pos, "invalid escape sequence \\x: expected 2 hex digits")
+		}
+	case 'u':
+		if v, ok := s.scanHexDigits(4, raw); ok && utf8.ValidRune(rune(v)) {
+			buf.WriteRune(rune(v))
+		} else {
+			s.setErr(pos, "invalid escape sequence \\u: expected 4 hex digits")
+		}
+	default:
+		s.setErr(pos, fmt.Sprintf("unknown escape sequence \\%c", ch))
+	}
+}
+
+// scanHexDigits reads n hex digits, copying them to raw
+func (s *Scanner) scanHexDigits(n int, raw *bytes.Buffer) (int, bool) {
+	v := 0
+	for i := 0; i < n; i++ {
+		ch := s.readRune()
+		d := hexValue(ch)
+		if d < 0 {
+			s.unreadRune()
+			return 0, false
+		}
+		raw.WriteRune(ch)
+		v = v*16 + d
+	}
+	return v, true
+}
+
+func (s *Scanner) scanRawStringLiteral(start Position) Token {
+	var buf bytes.Buffer
+	for {
+		ch := s.readRune()
+		if ch == eofChar {
+			s.setErr(start, "unterminated raw string literal")
+			return Token{ILLEGAL, "`" + buf.String(), start, s.pos}
+		}
+		if ch == '`' {
+			break
+		}
+		buf.WriteRune(ch)
+	}
+	return Token{STRING, buf.String(), start, s.pos}
+}
+
+// setErr records the first error in the token being scanned
+func (s *Scanner) setErr(pos Position, msg string) {
+	if s.err == nil {
+		s.err = &ScanError{pos, msg}
+	}
+}
+
 func (s *Scanner) scanNumberLiteral(first rune, start Position) Token {
 	var buf bytes.Buffer
 	buf.WriteRune(first)
 	for {
-		ch := s.readRune()
-		if isNumber(ch) || ch == '.' {
-			buf.WriteRune(ch)
-		} else {
-			s.unreadRune()
+		ch := s.peekRune(0)
+		if ch == '.' && (isLetter(s.peekRune(1)) || s.peekRune(1) == '_') {
+			// the dot begins a selector, as in 1.abs()
+			break
+		}
+		if !isNumber(ch) && ch != '.' {
 			break
 		}
+		buf.WriteRune(s.readRune())
+	}
+	if ch := s.peekRune(0); ch == 'e' || ch == 'E' {
+		if next := s.peekRune(1); isNumber(next) || next == '+' || next == '-' {
+			s.setErr(s.pos, "exponents are not supported in number literals")
+			buf.WriteRune(s.readRune())
+			buf.WriteRune(s.readRune())
+		}
+	}
+	// a type suffix, as in 10n or 1.50d, is checked by the parser
+	for ch := s.peekRune(0); isLetter(ch) || isNumber(ch) || ch == '_'; ch = s.peekRune(0) {
+		buf.WriteRune(s.readRune())
+	}
+	if s.err != nil {
+		return Token{ILLEGAL, buf.String(), start, s.pos}
 	}
 	return Token{NUMBER, buf.String(), start, s.pos}
 }
@@ -275,3 +495,16 @@ func isLetter(ch rune) bool {
 func isNumber(ch rune) bool {
 	return ch >= '0' && ch <= '9'
 }
+
+// hexValue returns the value of the hex digit ch, or -1
+func hexValue(ch rune) int {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return int(ch - '0')
+	case ch >= 'a' && ch <= 'f':
+		return int(ch-'a') + 10
+	case ch >= 'A' && ch <= 'F':
+		return int(ch-'A') + 10
+	}
+	return -1
+}
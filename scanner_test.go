@@ -16,9 +16,23 @@ func TestScannerScan(t *testing.T) {
 	}{
 		{"", mini.EOF, ""},
 		{"  ", mini.WS, "  "},
-		{"\"", mini.STRING, ""},
+		{"\"", mini.ILLEGAL, "\""},
+		{"\"foo", mini.ILLEGAL, "\"foo"},
+		{"\"foo\\", mini.ILLEGAL, "\"foo\\"},
 		{"\"\\\"\"", mini.STRING, "\""},
 		{"\"foo\"", mini.STRING, "foo"},
+		{`"a\nb\tc\rd"`, mini.STRING, "a\nb\tc\rd"},
+		{`"\\\""`, mini.STRING, `\"`},
+		{`"\x41\x7a"`, mini.STRING, "Az"},
+		{`"\u00e9\u4e16"`, mini.STRING, "\u00e9\u4e16"},
+		{"\"multi\nline\"", mini.STRING, "multi\nline"},
+		{`"\q"`, mini.ILLEGAL, `"\q"`},
+		{`"\x4"`, mini.ILLEGAL, `"\x4"`},
+		{`"\u12g4"`, mini.ILLEGAL, `"\u12g4"`},
+		{"`raw\\n`", mini.STRING, "raw\\n"},
+		{"`multi\nline`", mini.STRING, "multi\nline"},
+		{"``", mini.STRING, ""},
+		{"`foo", mini.ILLEGAL, "`foo"},
 		{"f", mini.IDENT, "f"},
 		{"foo", mini.IDENT, "foo"},
 		{"f123_oo", mini.IDENT, "f123_oo"},
@@ -30,10 +44,19 @@ func TestScannerScan(t *testing.T) {
 		},
 		{"123", mini.NUMBER, "123"},
 		{".123", mini.NUMBER, ".123"},
-		{".", mini.NUMBER, "."},
 		{"123.", mini.NUMBER, "123."},
 		{"123.456", mini.NUMBER, "123.456"},
-		{"...456...", mini.NUMBER, "...456..."},
+		{".456...", mini.NUMBER, ".456..."},
+		{"123.abs", mini.NUMBER, "123"},
+		{"1.5.abs", mini.NUMBER, "1.5"},
+		{"123n", mini.NUMBER, "123n"},
+		{"1.50d.round", mini.NUMBER, "1.50d"},
+		{"1e3", mini.ILLEGAL, "1e3"},
+		{"1.5E-2d", mini.ILLEGAL, "1.5E-2d"},
+		{"1else", mini.NUMBER, "1else"},
+		{".", mini.DOT, "."},
+		{".abs", mini.DOT, "."},
+		{"...456", mini.DOT, "."},
 		{"true", mini.BOOL, "true"},
 		{"false", mini.BOOL, "false"},
 		{"if", mini.IF, "if"},
@@ -43,6 +66,8 @@ func TestScannerScan(t *testing.T) {
 		{"continue", mini.CONTINUE, "continue"},
 		{"and", mini.AND, "and"},
 		{"or", mini.OR, "or"},
+		{"func", mini.FUNC, "func"},
+		{"return", mini.RETURN, "return"},
 		{"{", mini.CURLYOPEN, "{"},
 		{"}", mini.CURLYCLOSE, "}"},
 		{"(", mini.ROUNDOPEN, "("},
@@ -50,11 +75,16 @@ func TestScannerScan(t *testing.T) {
 		{"[", mini.SQUAREOPEN, "["},
 		{"]", mini.SQUARECLOSE, "]"},
 		{",", mini.COMMA, ","},
+		{":", mini.COLON, ":"},
 		{"=", mini.ASSIGN, "="},
 		{"+", mini.ADD, "+"},
 		{"-", mini.SUBTRACT, "-"},
 		{"*", mini.MULTIPLY, "*"},
 		{"/", mini.DIVIDE, "/"},
+		{"%", mini.MODULO, "%"},
+		{"**", mini.POWER, "**"},
+		{"~/", mini.FLOORDIVIDE, "~/"},
+		{"~", mini.ILLEGAL, "~"},
 		{"!", mini.NOT, "!"},
 		{"<", mini.LESS, "<"},
 		{">", mini.GREATER, ">"},
@@ -62,6 +92,11 @@ func TestScannerScan(t *testing.T) {
 		{">=", mini.GREATEREQUAL, ">="},
 		{"==", mini.EQUAL, "=="},
 		{"!=", mini.NOTEQUAL, "!="},
+		{"// foo", mini.COMMENT, "// foo"},
+		{"//foo\nbar", mini.COMMENT, "//foo"},
+		{"/* foo\n*/", mini.COMMENT, "/* foo\n*/"},
+		{"/***/", mini.COMMENT, "/***/"},
+		{"/* foo", mini.ILLEGAL, "/* foo"},
 	}
 
 	for _, test := range tests {
@@ -101,6 +136,61 @@ func TestScannerScanRepeated(t *testing.T) {
 	}
 }
 
+func TestScannerErr(t *testing.T) {
+	s := mini.NewScanner(strings.NewReader("foo /* bar"))
+	for _, tt := range []mini.TokenType{mini.IDENT, mini.WS} {
+		if tok := s.Scan(); tok.Type != tt || s.Err() != nil {
+			t.Fatalf("expected %v with no error, got %v, %v", tt, tok, s.Err())
+		}
+	}
+	tok := s.Scan()
+	if tok.Type != mini.ILLEGAL {
+		t.Fatalf("expected an ILLEGAL token, got %v", tok)
+	}
+	err, ok := s.Err().(*mini.ScanError)
+	if !ok {
+		t.Fatalf("expected a *ScanError, got %v", s.Err())
+	}
+	if err.Pos != pos(0, 4) {
+		t.Errorf("expected error at %v, got %v", pos(0, 4), err.Pos)
+	}
+}
+
+func TestScannerStringErr(t *testing.T) {
+	tests := []struct {
+		Program string
+		Pos     mini.Position
+	}{
+		{`"foo`, pos(0, 0)},
+		{"x = \"a\\qb\"", pos(0, 6)},
+		{"\"a\nb\\xZZ\"", pos(1, 1)},
+		{"`a\nb", pos(0, 0)},
+		{"x = 1e3", pos(0, 5)},
+		{"1.5e+2n", pos(0, 3)},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			s := mini.NewScanner(strings.NewReader(test.Program))
+			for {
+				tok := s.Scan()
+				if tok.Type == mini.EOF {
+					t.Fatal("expected an ILLEGAL token")
+				}
+				if tok.Type == mini.ILLEGAL {
+					break
+				}
+			}
+			err, ok := s.Err().(*mini.ScanError)
+			if !ok {
+				t.Fatalf("expected a *ScanError, got %v", s.Err())
+			}
+			if err.Pos != test.Pos {
+				t.Errorf("expected error at %v, got %v", test.Pos, err.Pos)
+			}
+		})
+	}
+}
+
 func pos(row, col int) mini.Position {
 	return mini.Position{Row: row, Col: col}
 }
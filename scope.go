@@ -0,0 +1,51 @@
+package mini
+
+// SymbolTable maps symbols to the objects bound to them
+type SymbolTable map[Symbol]Object
+
+// Scope is a lexical environment. Lookups which miss in a Scope continue in
+// its Parent.
+type Scope struct {
+	Symbols SymbolTable
+	Parent  *Scope
+}
+
+// NewScope constructs an empty Scope nested in parent, which may be nil
+func NewScope(parent *Scope) *Scope {
+	return &Scope{Symbols: make(SymbolTable), Parent: parent}
+}
+
+// Resolve returns the nearest scope, starting at s, which binds sym, or nil
+// if there is no such scope
+func (s *Scope) Resolve(sym Symbol) *Scope {
+	for ; s != nil; s = s.Parent {
+		if _, ok := s.Symbols[sym]; ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// Lookup returns the object bound to sym in the nearest scope which binds it,
+// or nil if sym is unbound
+func (s *Scope) Lookup(sym Symbol) Object {
+	if owner := s.Resolve(sym); owner != nil {
+		return owner.Symbols[sym]
+	}
+	return nil
+}
+
+// Assign rebinds sym in the nearest scope which binds it. If sym is unbound it
+// is defined in s.
+func (s *Scope) Assign(sym Symbol, obj Object) {
+	owner := s.Resolve(sym)
+	if owner == nil {
+		owner = s
+	}
+	owner.Symbols[sym] = obj
+}
+
+// Define binds sym in s, shadowing any binding in an enclosing scope
+func (s *Scope) Define(sym Symbol, obj Object) {
+	s.Symbols[sym] = obj
+}
@@ -10,6 +10,13 @@ var StdLib []Entry = []Entry{
 			return nil, err
 		},
 	},
+	{"int", convertInt},
+	{"float", convertFloat},
+	{"bigint", convertBigInt},
+	{"decimal", convertDecimal},
+	{"range", newRangeBuiltin},
+	{"error", newErrorBuiltin},
+	{"raise", raiseBuiltin},
 }
 
 func objectsToEmpties(args Args) []interface{} {
@@ -13,6 +13,10 @@ func (o String) IsNil() bool { return false }
 
 // Send helps String implement the Object interface
 func (o String) Send(op Op, args Args) (Object, error) {
+	return o.sendMetered(nil, op, args)
+}
+
+func (o String) sendMetered(m *meter, op Op, args Args) (Object, error) {
 	switch op {
 	case OpMul:
 		rhs, ok := args.Arg(0).(Number)
@@ -24,6 +28,9 @@ func (o String) Send(op Op, args Args) (Object, error) {
 		if !ok {
 			return nil, newErrTypeBadRhs(op, o, rhs, stringType)
 		}
+		if err := m.chargeString(len(o) + len(rhs)); err != nil {
+			return nil, err
+		}
 		return o + rhs, nil
 	case OpEq, OpNe, OpLt, OpLe, OpGt, OpGe:
 		rhs, ok := args.Arg(0).(String)
@@ -0,0 +1,73 @@
+package mini
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Frame is an entry in the stack trace of an Error: a call to the function
+// named Func at Pos in File
+type Frame struct {
+	Func string
+	File string
+	Pos  Position
+}
+
+func (f Frame) String() string {
+	if f.File == "" {
+		return fmt.Sprintf("in %s, called at %v", f.Func, f.Pos)
+	}
+	return fmt.Sprintf("in %s, called at %s:%v", f.Func, f.File, f.Pos)
+}
+
+// callSite is a call in progress
+type callSite struct {
+	callee Expression
+	pos    Position
+	file   string
+}
+
+// enterSite pushes a call of callee at pos onto the call stack, and returns
+// the depth to restore when it returns
+func (vm *Vm) enterSite(callee Expression, pos Position, file string) int {
+	n := len(vm.sites)
+	vm.sites = append(vm.sites, callSite{callee, pos, file})
+	return n
+}
+
+// callError wraps err, returned by the innermost call in progress, with the
+// position of the call and, unless it already has one, the stack trace
+func (vm *Vm) callError(err error, pos Position, span Span) error {
+	err = wrapError(err, pos, span)
+	if e, ok := err.(*Error); ok && e.Trace == nil {
+		e.Trace = make([]Frame, len(vm.sites))
+		for i, s := range vm.sites {
+			e.Trace[len(vm.sites)-1-i] = Frame{Func: calleeName(s.callee), File: s.file, Pos: s.pos}
+		}
+	}
+	return err
+}
+
+// calleeName names the function which callee evaluates to
+func calleeName(callee Expression) string {
+	switch e := callee.(type) {
+	case *Ident:
+		return string(e.Name)
+	case *SelectorExpr:
+		if base, ok := e.Base.(*Ident); ok {
+			return string(base.Name) + "." + e.Name
+		}
+		return e.Name
+	}
+	return "<anonymous>"
+}
+
+// Traceback formats the stack trace of e, innermost call first, one call per
+// line
+func (e *Error) Traceback() string {
+	var buf bytes.Buffer
+	for _, f := range e.Trace {
+		fmt.Fprintln(&buf, f)
+	}
+	return buf.String()
+}
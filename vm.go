@@ -1,18 +1,50 @@
 package mini
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"strings"
 )
 
-type SymbolTable map[Symbol]Object
+// Backend selects how a Vm evaluates programs
+type Backend int
+
+const (
+	// BytecodeBackend compiles programs to bytecode and runs them on a stack
+	// machine
+	BytecodeBackend Backend = iota
+	// TreeBackend evaluates the AST directly. It is kept as a reference
+	// implementation for testing the bytecode backend.
+	TreeBackend
+)
 
 type Vm struct {
-	Symbols SymbolTable
+	Globals *Scope
 	Result  Object
 	Debug   bool
+	Backend Backend
+	// MaxSteps limits the number of loop iterations and function calls,
+	// including calls to native functions, in each evaluation, if it is
+	// positive
+	MaxSteps int64
+	// MaxCallDepth limits how deeply function calls nest, if it is positive
+	MaxCallDepth int
+	// MaxAlloc limits the approximate number of bytes each evaluation may
+	// allocate, if it is positive
+	MaxAlloc int64
+	scope    *Scope
+	control  control
+	stack    []Object
+	ctx      context.Context
+	steps    int64
+	calls    int
+	meter    meter
+	// sites is the stack of calls in progress, innermost last
+	sites []callSite
+	// file is the source of the program being evaluated by the tree backend
+	file string
 }
 
 func NewVm() *Vm {
@@ -22,20 +54,92 @@ func NewVm() *Vm {
 }
 
 func NewMinimalVm() *Vm {
-	return &Vm{Symbols: make(SymbolTable)}
+	globals := NewScope(nil)
+	return &Vm{Globals: globals, scope: globals, MaxCallDepth: DefaultMaxCallDepth}
 }
 
 func (vm *Vm) Eval(r io.Reader) error {
-	expr, err := NewParser(r).Parse()
+	return vm.EvalContext(context.Background(), r)
+}
+
+// EvalContext is like Eval, but stops with a CanceledError once ctx is done
+func (vm *Vm) EvalContext(ctx context.Context, r io.Reader) error {
+	return vm.evalFile(ctx, "", r)
+}
+
+// EvalFile is like Eval, but errors refer to the source as file
+func (vm *Vm) EvalFile(file string, r io.Reader) error {
+	return vm.evalFile(context.Background(), file, r)
+}
+
+func (vm *Vm) evalFile(ctx context.Context, file string, r io.Reader) error {
+	expr, err := NewFileParser(file, r).Parse()
 	if vm.Debug {
 		log.Println("AST:", expr)
 	}
 	if err != nil {
+		vm.Result = NIL
 		return err
 	}
-	vm.Result, err = expr.Eval(vm)
+	p := &Program{expr: expr, file: file}
+	if vm.Backend != TreeBackend {
+		if p.proto, err = compile(expr, file); err != nil {
+			vm.Result = NIL
+			return err
+		}
+	}
+	return vm.EvalProgramContext(ctx, p)
+}
+
+// EvalProgram evaluates p in the global scope and stores the result in
+// vm.Result, which is NIL if the evaluation fails
+func (vm *Vm) EvalProgram(p *Program) error {
+	return vm.EvalProgramContext(context.Background(), p)
+}
+
+// EvalProgramContext is like EvalProgram, but stops with a CanceledError
+// once ctx is done. Errors other than those which stop the evaluation are
+// reported as an *Error.
+func (vm *Vm) EvalProgramContext(ctx context.Context, p *Program) (err error) {
+	if err := ctx.Err(); err != nil {
+		vm.Result = NIL
+		return &CanceledError{err}
+	}
+	prev := vm.ctx
+	defer func() { vm.ctx = prev }()
+	vm.ctx = nil
+	if ctx.Done() != nil {
+		vm.ctx = ctx
+	}
+	vm.steps = 0
+	vm.meter = meter{limit: vm.MaxAlloc}
+	if vm.Backend == TreeBackend {
+		prevFile := vm.file
+		vm.file = p.file
+		defer func() { vm.file = prevFile }()
+		prev := vm.swapScope(vm.Globals)
+		vm.Result, err = p.expr.Eval(vm)
+		vm.Result = vm.catchReturn(vm.Result)
+		vm.control = control{}
+		vm.swapScope(prev)
+	} else {
+		if vm.Debug {
+			log.Print("Bytecode:\n", p.proto)
+		}
+		vm.Result, err = vm.run(p.proto, nil, vm.Globals)
+	}
 	if vm.Debug {
-		log.Println("Symbols:", vm.Symbols)
+		log.Println("Globals:", vm.Globals.Symbols)
+	}
+	if err != nil {
+		// the backends stop at different points, so neither partial result
+		// is meaningful
+		vm.Result = NIL
+	}
+	if err != nil && !isFatal(err) {
+		e := asError(err)
+		setFile(e, p.file)
+		return e
 	}
 	return err
 }
@@ -44,12 +148,25 @@ func (vm *Vm) EvalString(s string) error {
 	return vm.Eval(strings.NewReader(s))
 }
 
+// SetGlobal binds sym to obj in the global scope
+func (vm *Vm) SetGlobal(sym Symbol, obj Object) {
+	vm.Globals.Define(sym, obj)
+}
+
+// Global returns the object bound to sym in the global scope, or nil
+func (vm *Vm) Global(sym Symbol) Object {
+	return vm.Globals.Symbols[sym]
+}
+
+// Assign rebinds sym in the current scope, see Scope.Assign
 func (vm *Vm) Assign(sym Symbol, obj Object) {
-	vm.Symbols[sym] = obj
+	vm.scope.Assign(sym, obj)
 }
 
+// Lookup returns the object bound to sym in the current scope, see
+// Scope.Lookup
 func (vm *Vm) Lookup(sym Symbol) Object {
-	return vm.Symbols[sym]
+	return vm.scope.Lookup(sym)
 }
 
 func (vm *Vm) Call(sym Symbol, args Args) (Object, error) {
@@ -62,6 +179,13 @@ func (vm *Vm) Call(sym Symbol, args Args) (Object, error) {
 
 func (vm *Vm) LoadLib(entries []Entry) {
 	for _, entry := range entries {
-		vm.Assign(entry.Name, entry.Func)
+		vm.SetGlobal(entry.Name, entry.Func)
 	}
 }
+
+// swapScope makes s the current scope and returns the previous one
+func (vm *Vm) swapScope(s *Scope) *Scope {
+	prev := vm.scope
+	vm.scope = s
+	return prev
+}
@@ -0,0 +1,1354 @@
+package mini_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jncornett/mini"
+)
+
+var backends = []struct {
+	Name    string
+	Backend mini.Backend
+}{
+	{"bytecode", mini.BytecodeBackend},
+	{"tree", mini.TreeBackend},
+}
+
+var evalTests = []struct {
+	Program        string
+	ExpectError    bool
+	ExpectedResult string
+}{
+	{
+		"1 + 2",
+		false,
+		"3",
+	},
+	{
+		"2 * 3 + 4",
+		false,
+		"10",
+	},
+	{
+		"10 - 4 - 3",
+		false,
+		"3",
+	},
+	{
+		"16 / 4 / 2",
+		false,
+		"2",
+	},
+	{
+		"1 + 2 * 3 == 7 and 2 < 3",
+		false,
+		"true",
+	},
+	{
+		"[7 % 3, -7 % 3, 7 % -3, 7.5 % 2]",
+		false,
+		"[1, 2, -2, 1.5]",
+	},
+	{
+		"[7 ~/ 2, -7 ~/ 2, 7.5 ~/ 2]",
+		false,
+		"[3, -4, 3]",
+	},
+	{
+		"[2 ** 10, 2 ** 3 ** 2, -2 ** 2, 4 ** 0.5]",
+		false,
+		"[1024, 512, -4, 2]",
+	},
+	{
+		"1 % 0",
+		true,
+		"",
+	},
+	{
+		"1 ~/ 0",
+		true,
+		"",
+	},
+	{
+		"7 // 2",
+		true,
+		"",
+	},
+	{
+		"f = func(a, b) { a } f(1,,2)",
+		true,
+		"",
+	},
+	{
+		"9007199254740993 + 0",
+		false,
+		"9007199254740993",
+	},
+	{
+		"[7 / 2, 1 + 0.5, 2 * 1.5, 2 ** 62, 2 ** -1]",
+		false,
+		"[3.5, 1.5, 3, 4611686018427387904, 0.5]",
+	},
+	{
+		"[2 == 2.0, 9007199254740993 == 9007199254740992.0, 1 < 1.5, 2 >= 2.0]",
+		false,
+		"[true, false, true, true]",
+	},
+	{
+		"m = {1: \"a\"} m[1.0]",
+		false,
+		"a",
+	},
+	{
+		"[1, 2, 3][1.0]",
+		false,
+		"2",
+	},
+	{
+		"9223372036854775807 + 1",
+		true,
+		"",
+	},
+	{
+		"-9223372036854775807 - 2",
+		true,
+		"",
+	},
+	{
+		"3037000500 * 3037000500",
+		true,
+		"",
+	},
+	{
+		"2 ** 63",
+		true,
+		"",
+	},
+	{
+		"99999999999999999999",
+		true,
+		"",
+	},
+	{
+		"[0.1d + 0.2d, 0.1d + 0.2d == 0.3d, 1d / 3d, 10d ** -2]",
+		false,
+		"[0.3, true, 0.3333333333333333333333333333, 0.01]",
+	},
+	{
+		"[(1d / 3d).round(2), 2.675d.round(2), 2.5d.round(), 1.5d.floor()]",
+		false,
+		"[0.33, 2.68, 2, 1]",
+	},
+	{
+		"[123d.round(-1), 1234.5d.round(-2), 1250d.round(-2), -55d.round(-1), 4d.round(-1)]",
+		false,
+		"[120, 1200, 1200, -60, 0]",
+	},
+	{
+		"[2n ** 100, 9223372036854775807n + 1, 7n / 2n, -7n ~/ 2n, -7n % 2n]",
+		false,
+		"[1267650600228229401496703205376, 9223372036854775808, 3.5, -4, 1]",
+	},
+	{
+		"[1.5d * 2, 1.5d + 0.5, 2n < 3.5, 1n == 1.0d]",
+		false,
+		"[3, 2, true, true]",
+	},
+	{
+		"m = {1: \"a\", 0.5: \"b\"}\n[m[1n], m[1.0d], m[0.5d]]",
+		false,
+		"[a, a, b]",
+	},
+	{
+		"n = 0 for x in [1, 2, 3] { n = n + x } n",
+		false,
+		"6",
+	},
+	{
+		"xs = [] for i, ch in \"héllo\" { xs.push(i, ch) } xs",
+		false,
+		"[0, h, 1, é, 2, l, 3, l, 4, o]",
+	},
+	{
+		"xs = [] for k, v in {\"a\": 1, \"b\": 2} { xs.push([k, v]) } xs",
+		false,
+		"[[a, 1], [b, 2]]",
+	},
+	{
+		"xs = [] for v in {\"a\": 1, \"b\": 2} { xs.push(v) } xs",
+		false,
+		"[1, 2]",
+	},
+	{
+		"[range(3), range(1, 4), range(10, 0, -3)]",
+		false,
+		"[range(0, 3, 1), range(1, 4, 1), range(10, 0, -3)]",
+	},
+	{
+		"xs = [] for x in range(10, 0, -3) { xs.push(x) } xs",
+		false,
+		"[10, 7, 4, 1]",
+	},
+	{
+		"n = 0 for i in range(100) { if i >= 5 { break } if i % 2 == 0 { continue } n = n + i } n",
+		false,
+		"4",
+	},
+	{
+		"n = 0 outer: for i in range(3) { for j in range(3) { if j >= 1 { continue outer } n = n + 1 } } n",
+		false,
+		"3",
+	},
+	{
+		"fs = [] for i in range(3) { fs.push(func() { i }) } [fs[0](), fs[2]()]",
+		false,
+		"[0, 2]",
+	},
+	{
+		"for x in [1] { y = x } y",
+		false,
+		"nil",
+	},
+	{
+		"f = func() { for x in range(10) { if x >= 2 { return x } } } f()",
+		false,
+		"2",
+	},
+	{
+		"for x in 1 { }",
+		true,
+		"",
+	},
+	{
+		"range(1, 2, 0)",
+		true,
+		"",
+	},
+	{
+		"try { 1 / 0 } catch e { [e.kind(), e.message(), e.line(), e.column()] }",
+		false,
+		"[ZeroDivisionError, Divide by zero, 1, 9]",
+	},
+	{
+		"try { [1] + 1 } catch e { e.kind() }",
+		false,
+		"TypeError",
+	},
+	{
+		"try { nil.foo } catch e { e.kind() }",
+		false,
+		"TypeError",
+	},
+	{
+		"try { 1 - \"a\" } catch e { e.kind() }",
+		false,
+		"TypeError",
+	},
+	{
+		"f = func() { raise(\"bad rule\") }\ntry { f() } catch e { [e.kind(), e.message(), e.line()] }",
+		false,
+		"[UserError, bad rule, 1]",
+	},
+	{
+		"try { raise({\"code\": 7}) } catch e { e.value()[\"code\"] }",
+		false,
+		"7",
+	},
+	{
+		"e = error(\"saved\") try { raise(e) } catch caught { caught == e }",
+		false,
+		"true",
+	},
+	{
+		"x = try { 1 } catch { 2 } x",
+		false,
+		"1",
+	},
+	{
+		"log = [] try { log.push(1) } finally { log.push(2) } log",
+		false,
+		"[1, 2]",
+	},
+	{
+		"log = [] try { try { 1 / 0 } finally { log.push(\"f\") } } catch { log.push(\"c\") } log",
+		false,
+		"[f, c]",
+	},
+	{
+		"log = [] f = func() { try { return 1 } finally { log.push(2) } 3 } [f(), log]",
+		false,
+		"[1, [2]]",
+	},
+	{
+		"n = 0 for i in range(5) { try { if i >= 2 { break } n = n + 1 } finally { n = n + 10 } } n",
+		false,
+		"32",
+	},
+	{
+		"try { 1 / 0 } catch e { raise(e) }",
+		true,
+		"",
+	},
+	{
+		"try { 1 / 0 } finally { }",
+		true,
+		"",
+	},
+	{
+		"raise(\"boom\")",
+		true,
+		"",
+	},
+	{
+		"[int(\"42\"), int(3.9), bigint(\"12345678901234567890\"), float(1.5d), decimal(0.1) == 0.1d]",
+		false,
+		"[42, 3, 12345678901234567890, 1.5, true]",
+	},
+	{
+		"1x",
+		true,
+		"",
+	},
+	{
+		"1d / 0d",
+		true,
+		"",
+	},
+	{
+		"int(9223372036854775808n)",
+		true,
+		"",
+	},
+	{
+		"a +",
+		true,
+		"",
+	},
+	{
+		"add = func(a, b) { a + b } add(1, 2)",
+		false,
+		"3",
+	},
+	{
+		"f = func(a, b) { b } f(1)",
+		false,
+		"nil",
+	},
+	{
+		"a = 1 f = func(a) { a } f(2) a",
+		false,
+		"1",
+	},
+	{
+		"x = 1 if true { x = 2 } x",
+		false,
+		"2",
+	},
+	{
+		"if true { y = 2 } y",
+		false,
+		"nil",
+	},
+	{
+		"f = func() { z = 1 } f() z",
+		false,
+		"nil",
+	},
+	{
+		"counter = func() { n = 0 func() { n = n + 1 } } c = counter() c() c()",
+		false,
+		"2",
+	},
+	{
+		"counter = func() { n = 0 func() { n = n + 1 } } a = counter() b = counter() a() a() b()",
+		false,
+		"1",
+	},
+	{
+		"if false { 1 } else { 2 }",
+		false,
+		"2",
+	},
+	{
+		"x = 0 if true { x = 1 } else { x = 2 } x",
+		false,
+		"1",
+	},
+	{
+		"if { 1 } else { 2 }",
+		false,
+		"1",
+	},
+	{
+		"x = 0 if false { x = 1 } x",
+		false,
+		"0",
+	},
+	{
+		"i = 0 for { i = i + 1 if i >= 3 { break } } i",
+		false,
+		"3",
+	},
+	{
+		"i = 0 n = 0 for i < 5 { i = i + 1 if i >= 2 { if i <= 2 { continue } } n = n + i } n",
+		false,
+		"13",
+	},
+	{
+		"i = 0 n = 0 outer: for i < 3 { i = i + 1 j = 0 for j < 3 { j = j + 1 if j >= 2 { continue outer } n = n + 1 } } n",
+		false,
+		"3",
+	},
+	{
+		"n = 0 outer: for { for { n = n + 1 break outer } n = 100 } n",
+		false,
+		"1",
+	},
+	{
+		"f = func(n) { if n < 0 { return 0 } n } f(-1)",
+		false,
+		"0",
+	},
+	{
+		"f = func(n) { if n < 0 { return 0 } n } f(1)",
+		false,
+		"1",
+	},
+	{
+		"f = func() { return } f()",
+		false,
+		"nil",
+	},
+	{
+		"f = func() { i = 0 for { i = i + 1 if i >= 3 { return i } } } f()",
+		false,
+		"3",
+	},
+	{
+		"fact = func(n) { if n < 2 { return 1 } n * fact(n - 1) } fact(5)",
+		false,
+		"120",
+	},
+	{
+		"x = 1 return x x = 2",
+		false,
+		"1",
+	},
+	{
+		"x = 1 if x > 0 { return x + 1 } x = 2",
+		false,
+		"2",
+	},
+	{
+		"[1, \"a\", [true]]",
+		false,
+		"[1, a, [true]]",
+	},
+	{
+		"xs = [1, 2, 3] xs[0] + xs[-1]",
+		false,
+		"4",
+	},
+	{
+		"xs = [1, 2, 3] xs[1] = 5 xs",
+		false,
+		"[1, 5, 3]",
+	},
+	{
+		"xs = [[1], [2]] xs[1][0] = 3 xs",
+		false,
+		"[[1], [3]]",
+	},
+	{
+		"[1] + [2, 3]",
+		false,
+		"[1, 2, 3]",
+	},
+	{
+		"xs = [1] ys = xs ys[0] = 2 xs",
+		false,
+		"[2]",
+	},
+	{
+		"[1, 2][2]",
+		true,
+		"",
+	},
+	{
+		"[1, 2][-3]",
+		true,
+		"",
+	},
+	{
+		"[1, 2][0.5]",
+		true,
+		"",
+	},
+	{
+		"[1] + 1",
+		true,
+		"",
+	},
+	{
+		"{\"a\": 1, 2: true}",
+		false,
+		"{a: 1, 2: true}",
+	},
+	{
+		"m = {\"a\": 1, \"b\": 2} m[\"b\"]",
+		false,
+		"2",
+	},
+	{
+		"m = {} m[\"missing\"]",
+		false,
+		"nil",
+	},
+	{
+		"m = {1: \"a\"} m[1] = \"b\" m[true] = \"c\" m",
+		false,
+		"{1: b, true: c}",
+	},
+	{
+		"{\"a\": [1]} == {\"a\": [1]}",
+		false,
+		"true",
+	},
+	{
+		"{\"a\": 1} != {\"a\": 2}",
+		false,
+		"true",
+	},
+	{
+		"{[1]: 2}",
+		true,
+		"",
+	},
+	{
+		"m = {} m[{}] = 1",
+		true,
+		"",
+	},
+	{
+		`"a\tb" + "\n"`,
+		false,
+		"a\tb\n",
+	},
+	{
+		"`C:\\dir\\` + `\nline`",
+		false,
+		"C:\\dir\\\nline",
+	},
+	{
+		`"bad \escape"`,
+		true,
+		"",
+	},
+	{
+		"\"Hello\".upper() + \"Hello\".lower()",
+		false,
+		"HELLOhello",
+	},
+	{
+		"\" a,b \".trim().split(\",\").join(\"-\")",
+		false,
+		"a-b",
+	},
+	{
+		"xs = [1] xs.push(2, 3).len()",
+		false,
+		"3",
+	},
+	{
+		"xs = [1, 2] xs.pop() + xs.len()",
+		false,
+		"3",
+	},
+	{
+		"[1, 2].contains(2)",
+		false,
+		"true",
+	},
+	{
+		"m = {\"a\": 1, \"b\": 2} m.delete(\"a\")\n[m.keys(), m.values(), m.has(\"a\")]",
+		false,
+		"[[b], [2], false]",
+	},
+	{
+		"n = -1.5\n[n.floor(), n.ceil(), n.abs(), 2.5.round()]",
+		false,
+		"[-2, -1, 1.5, 3]",
+	},
+	{
+		"f = [1, 2].len f()",
+		false,
+		"2",
+	},
+	{
+		"fs = [func(x) { x * 2 }] fs[0](21)",
+		false,
+		"42",
+	},
+	{
+		"1.nope()",
+		true,
+		"",
+	},
+	{
+		"[].pop()",
+		true,
+		"",
+	},
+	{
+		"\"abc\".split(1)",
+		true,
+		"",
+	},
+	{
+		"f = 1 f()",
+		true,
+		"",
+	},
+}
+
+func TestVmEval(t *testing.T) {
+	for _, backend := range backends {
+		for _, test := range evalTests {
+			t.Run(backend.Name+"/"+test.Program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				err := vm.EvalString(test.Program)
+				if test.ExpectError {
+					if err == nil {
+						t.Fatal("expected an error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				result := fmt.Sprint(vm.Result)
+				if test.ExpectedResult != result {
+					t.Errorf("expected %q, got %q", test.ExpectedResult, result)
+				}
+			})
+		}
+	}
+}
+
+// TestVmBackendsAgree checks that the bytecode backend matches the reference
+// tree backend, including the globals each program leaves behind
+func TestVmBackendsAgree(t *testing.T) {
+	programs := []string{
+		"x = 1 f = func() { x = 2 } f() x",
+		"f = func() { y = 1 g = func() { y = y + 1 } g() y } f()",
+		"if true { a = 1 if true { a = 2 b = 3 } [a, b] }",
+		"n = nil if true { n = 1 } n",
+		"r = print if true { r = 1 } r",
+		"f = func(a) { if a > 0 { a = a - 1 } a } f(3)",
+		"fs = [] i = 0 for i < 3 { j = i fs.push(func() { j }) i = i + 1 } [fs[0](), fs[2]()]",
+		"fs = [] for x, y in [4, 5] { fs.push(func() { x + y }) } [fs[0](), fs[1]()]",
+		"for x, x in [7] { x }",
+		"xs = [] outer: for i in range(3) { for j in range(3) { if j > i { continue outer } if i == 2 { break outer } xs.push([i, j]) } } xs",
+		"n = 0 for { n = n + 1 if n > 3 { break } } n",
+		"x = for false { }",
+		"x = for v in [1, 2] { v } x",
+		"f = func() { for i in range(10) { try { if i == 3 { return i } } finally { log.push(i) } } } log = [] [f(), log]",
+		"f = func() { try { return 1 } finally { return 2 } } f()",
+		"n = 0 for i in range(3) { try { continue } finally { n = n + 1 } } n",
+		"log = [] try { try { raise(\"a\") } catch e { raise(\"b\") } finally { log.push(1) } } catch e { log.push(e.message()) } log",
+		"try { try { 1 / 0 } finally { raise(\"inner\") } } catch e { e.message() }",
+		"for i in range(2) { try { break } catch { } } i",
+		"try { x = 1 [1] + 1 } catch e { [x, e.kind()] }",
+		"f = func() { try { 1 / 0 } catch { return 5 } 6 } f()",
+		"a = [] b = a and [1] c = [2] and [] [b, c, 1 or 2, nil or false]",
+		"not nil",
+		"()",
+		"f = func() { } f()",
+		"[1, 2] + [3]",
+		"x = [print(), 1]",
+		"m = {\"a\": 1} m[\"b\"] = 2 m",
+		"f = func(n) { if n < 2 { return n } f(n - 1) + f(n - 2) } f(15)",
+		"try { undefined() } catch e { e.message() }",
+		"undefined()",
+		"1 + [1]",
+		"{[1]: 2}",
+		"for x in 5 { }",
+		"f = func(a, b) { [a, b] } f(1)",
+		"return 1 2",
+		"x = 1 return",
+	}
+	for _, program := range programs {
+		t.Run(program, func(t *testing.T) {
+			var results, errs, globals [2]string
+			for i, backend := range backends {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				vm.SetGlobal("log", mini.NewList())
+				err := vm.EvalString(program)
+				results[i] = fmt.Sprint(vm.Result)
+				errs[i] = fmt.Sprint(err)
+				var names []string
+				for name, obj := range vm.Globals.Symbols {
+					if _, ok := obj.(mini.Function); !ok {
+						names = append(names, fmt.Sprint(name, "=", obj))
+					}
+				}
+				sort.Strings(names)
+				globals[i] = strings.Join(names, " ")
+			}
+			if results[0] != results[1] || errs[0] != errs[1] || globals[0] != globals[1] {
+				t.Errorf("backends disagree:\n  bytecode: %s (err %s) {%s}\n  tree:     %s (err %s) {%s}",
+					results[0], errs[0], globals[0], results[1], errs[1], globals[1])
+			}
+		})
+	}
+}
+
+func TestVmSetGlobal(t *testing.T) {
+	vm := mini.NewVm()
+	vm.SetGlobal("limit", mini.Number(3))
+	err := vm.EvalString("n = 0 for n < limit { n = n + 1 }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := vm.Global("n"); n != mini.Int(3) {
+		t.Errorf("expected n to be 3, got %v", n)
+	}
+}
+
+func TestVmMapGlobal(t *testing.T) {
+	config := mini.NewMap()
+	if err := config.Set(mini.String("retries"), mini.Number(2)); err != nil {
+		t.Fatal(err)
+	}
+	vm := mini.NewVm()
+	vm.SetGlobal("config", config)
+	err := vm.EvalString("config[\"retries\"] = config[\"retries\"] + 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	retries, ok, err := config.Get(mini.String("retries"))
+	if err != nil || !ok || retries != mini.Number(3) {
+		t.Errorf("expected retries to be 3, got %v", retries)
+	}
+}
+
+type counter struct {
+	n int
+}
+
+func (o *counter) Truthy() bool { return true }
+
+func (o *counter) IsNil() bool { return false }
+
+func (o *counter) Send(mini.Op, mini.Args) (mini.Object, error) { return nil, nil }
+
+func (o *counter) Method(name string) mini.Function {
+	switch name {
+	case "incr":
+		return func(args mini.Args) (mini.Object, error) {
+			o.n++
+			return mini.Number(o.n), nil
+		}
+	}
+	return nil
+}
+
+func TestVmCustomReceiver(t *testing.T) {
+	c := &counter{}
+	vm := mini.NewVm()
+	vm.SetGlobal("c", c)
+	if err := vm.EvalString("c.incr() c.incr()"); err != nil {
+		t.Fatal(err)
+	}
+	if vm.Result != mini.Number(2) || c.n != 2 {
+		t.Errorf("expected 2 calls, got result %v and count %v", vm.Result, c.n)
+	}
+	if err := vm.EvalString("c.decr()"); err == nil {
+		t.Error("expected an error calling a missing method")
+	}
+}
+
+// countdown is an Iterable which yields n, n-1, ... 1
+type countdown int
+
+func (o countdown) Truthy() bool { return true }
+
+func (o countdown) IsNil() bool { return false }
+
+func (o countdown) Send(mini.Op, mini.Args) (mini.Object, error) { return nil, nil }
+
+func (o countdown) Iterate() mini.Iterator { return &countdownIterator{n: int(o) + 1} }
+
+type countdownIterator struct {
+	n int
+}
+
+func (it *countdownIterator) Next() bool {
+	if it.n > 0 {
+		it.n--
+	}
+	return it.n > 0
+}
+
+func (it *countdownIterator) Key() mini.Object { return mini.NIL }
+
+func (it *countdownIterator) Value() mini.Object { return mini.Int(it.n) }
+
+func TestVmCustomIterable(t *testing.T) {
+	vm := mini.NewVm()
+	vm.SetGlobal("countdown", countdown(3))
+	if err := vm.EvalString("xs = [] for x in countdown { xs.push(x) } xs"); err != nil {
+		t.Fatal(err)
+	}
+	if result := fmt.Sprint(vm.Result); result != "[3, 2, 1]" {
+		t.Errorf("expected [3, 2, 1], got %v", result)
+	}
+}
+
+func TestVmZeroDivision(t *testing.T) {
+	for _, program := range []string{"1 / 0", "1 % 0", "1 ~/ 0"} {
+		t.Run(program, func(t *testing.T) {
+			err := mini.NewVm().EvalString(program)
+			if mini.Cause(err) != mini.ErrZeroDivision {
+				t.Errorf("expected ErrZeroDivision, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVmIntPromotion(t *testing.T) {
+	tests := []struct {
+		Program  string
+		Expected mini.Object
+	}{
+		{"1 + 2", mini.Int(3)},
+		{"7 ~/ 2", mini.Int(3)},
+		{"7 % 2", mini.Int(1)},
+		{"1.0", mini.Number(1)},
+		{"1 + 2.0", mini.Number(3)},
+		{"2.0 * 3", mini.Number(6)},
+		{"6 / 3", mini.Number(2)},
+		{"[1, 2].len()", mini.Int(2)},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			vm := mini.NewVm()
+			if err := vm.EvalString(test.Program); err != nil {
+				t.Fatal(err)
+			}
+			if vm.Result != test.Expected {
+				t.Errorf("expected %#v, got %#v", test.Expected, vm.Result)
+			}
+		})
+	}
+}
+
+func TestVmBigNumberPromotion(t *testing.T) {
+	tests := []struct {
+		Program  string
+		Expected string
+	}{
+		{"1 + 1n", "mini.BigInt"},
+		{"1n + 1d", "mini.Decimal"},
+		{"1 + 1d", "mini.Decimal"},
+		{"1d + 1.0", "mini.Number"},
+		{"1n + 1.0", "mini.Number"},
+		{"4n / 2n", "mini.Decimal"},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			vm := mini.NewVm()
+			if err := vm.EvalString(test.Program); err != nil {
+				t.Fatal(err)
+			}
+			if typ := fmt.Sprintf("%T", vm.Result); typ != test.Expected {
+				t.Errorf("expected %v, got %v", test.Expected, typ)
+			}
+		})
+	}
+}
+
+func TestVmErrorPosition(t *testing.T) {
+	err := mini.NewVm().EvalString("x = 1\ny = x + \"a\"")
+	e, ok := err.(*mini.Error)
+	if !ok {
+		t.Fatalf("expected a *mini.Error, got %T", err)
+	}
+	if e.Kind != mini.ErrorType || !e.HasPos || e.Pos.String() != "2:7" {
+		t.Errorf("expected a TypeError at 2:7, got %v at %v", e.Kind, e.Pos)
+	}
+}
+
+func TestVmErrorFile(t *testing.T) {
+	tests := []struct {
+		Program  string
+		Expected string
+	}{
+		{"x = 1\ny = x + \"a\"", "rules.mini:2:7"},
+		{"f = func() {\n  1 / 0\n}\nf()", "rules.mini:2:5"},
+		{"for x in 5 { }", "rules.mini:1:10"},
+		{"m = {1: 2,\n  [3]: 4}", "rules.mini:2:3"},
+		{"try { 1 / 0 } catch e { raise(e.file()) }", "rules.mini:1:30"},
+	}
+	for _, backend := range backends {
+		for _, test := range tests {
+			t.Run(backend.Name+"/"+test.Program, func(t *testing.T) {
+				prog, err := mini.CompileFile("rules.mini", test.Program)
+				if err != nil {
+					t.Fatal(err)
+				}
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				_, err = prog.Run(vm)
+				e, ok := err.(*mini.Error)
+				if !ok {
+					t.Fatalf("expected a *mini.Error, got %v", err)
+				}
+				if pos := fmt.Sprintf("%s:%d:%d", e.File, e.Line(), e.Column()); pos != test.Expected {
+					t.Errorf("expected an error at %s, got %s", test.Expected, pos)
+				}
+				if !strings.HasSuffix(err.Error(), " at "+test.Expected) {
+					t.Errorf("expected the message to end with the position, got %q", err.Error())
+				}
+				if e.Msg != "rules.mini" && e.Kind == mini.ErrorUser {
+					t.Errorf("expected caught errors to know their file, got %q", e.Msg)
+				}
+			})
+		}
+	}
+}
+
+func TestVmIntOverflow(t *testing.T) {
+	err := mini.NewVm().EvalString("9223372036854775807 + 1")
+	if mini.Cause(err) != mini.ErrOverflow {
+		t.Errorf("expected ErrOverflow, got %v", err)
+	}
+}
+
+func TestProgramRun(t *testing.T) {
+	prog, err := mini.Compile("n = n + 1 f = func(x) { x * n } f(10)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, backend := range backends {
+		t.Run(backend.Name, func(t *testing.T) {
+			vm := mini.NewVm()
+			vm.Backend = backend.Backend
+			vm.SetGlobal("n", mini.Int(0))
+			for i, expected := range []string{"10", "20", "30"} {
+				result, err := prog.Run(vm)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fmt.Sprint(result) != expected {
+					t.Errorf("run %d: expected %s, got %v", i, expected, result)
+				}
+			}
+		})
+	}
+}
+
+func TestProgramConcurrentRun(t *testing.T) {
+	prog, err := mini.Compile("total = 0 for i in range(n) { total = total + i } total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	results := make([]mini.Object, 8)
+	errs := make([]error, len(results))
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			vm := mini.NewVm()
+			vm.SetGlobal("n", mini.Int(i*100))
+			results[i], errs[i] = prog.Run(vm)
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		n := int64(i * 100)
+		if expected := mini.Int(n * (n - 1) / 2); result != expected {
+			t.Errorf("n=%d: expected %v, got %v", n, expected, result)
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	for _, src := range []string{"(1", "1 + ", "break"} {
+		t.Run(src, func(t *testing.T) {
+			if _, err := mini.Compile(src); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestVmStepLimit(t *testing.T) {
+	for _, backend := range backends {
+		for _, program := range []string{
+			"for true { }",
+			"for x in range(1000000) { }",
+			"try { for true { } } catch { 1 }",
+			"f = func() { for true { } } try { f() } finally { g() }",
+		} {
+			t.Run(backend.Name+"/"+program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				vm.MaxSteps = 1000
+				err := vm.EvalString(program)
+				if e, ok := err.(*mini.StepLimitError); !ok || e.Limit != 1000 {
+					t.Fatalf("expected a StepLimitError, got %v", err)
+				}
+				if err := vm.EvalString("for x in range(500) { }"); err != nil {
+					t.Errorf("expected the budget to be reset, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestVmCallDepth(t *testing.T) {
+	for _, backend := range backends {
+		for _, program := range []string{
+			"f = func() { f() } f()",
+			"f = func() { try { f() } catch { 1 } } f()",
+		} {
+			t.Run(backend.Name+"/"+program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				err := vm.EvalString(program)
+				if e, ok := err.(*mini.CallDepthError); !ok || e.Limit != mini.DefaultMaxCallDepth {
+					t.Fatalf("expected a CallDepthError, got %v", err)
+				}
+				if err := vm.EvalString("g = func(n) { if n > 0 { g(n - 1) } } g(100)"); err != nil {
+					t.Errorf("expected the call depth to be reset, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestVmEvalContext(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.Name, func(t *testing.T) {
+			vm := mini.NewVm()
+			vm.Backend = backend.Backend
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			err := vm.EvalContext(ctx, strings.NewReader("try { for true { } } catch { 1 }"))
+			if e, ok := err.(*mini.CanceledError); !ok || e.Err != context.DeadlineExceeded {
+				t.Fatalf("expected a CanceledError, got %v", err)
+			}
+			err = vm.EvalContext(ctx, strings.NewReader("1"))
+			if _, ok := err.(*mini.CanceledError); !ok {
+				t.Errorf("expected a CanceledError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVmEvalContextExpensiveSteps(t *testing.T) {
+	for _, backend := range backends {
+		for _, program := range []string{
+			"x = 3n ** 2000000n for true { y = x * x }",
+			"x = 2d ** 20000 / 3d for true { y = x * x / 7d }",
+			`s = "ab" for i in range(20) { s = s + s } for true { t = s + s }`,
+			`xs = [] for i in range(100000) { xs.push(i) } for true { s = xs.join(",") }`,
+		} {
+			t.Run(backend.Name+"/"+program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				start := time.Now()
+				err := vm.EvalContext(ctx, strings.NewReader(program))
+				if e, ok := err.(*mini.CanceledError); !ok || e.Err != context.DeadlineExceeded {
+					t.Fatalf("expected a CanceledError, got %v", err)
+				}
+				if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+					t.Errorf("expected the evaluation to stop within its deadline, took %v", elapsed)
+				}
+			})
+		}
+	}
+}
+
+func TestVmHugeResult(t *testing.T) {
+	tests := []struct {
+		Program string
+		Kind    mini.ErrorKind
+	}{
+		{"7n ** 300000000n", mini.ErrorOverflow},
+		{"5n ** 10000000000n", mini.ErrorOverflow},
+		{"1.5d ** 300000000", mini.ErrorOverflow},
+		{"x = 7n ** 300000000", mini.ErrorOverflow},
+		{"x = 3n for true { x = x * x }", mini.ErrorOverflow},
+		{"x = 3d for true { x = x * x / 7d }", mini.ErrorOverflow},
+		{"x = 30d for true { x = x * x ~/ 7d }", mini.ErrorOverflow},
+		{`s = "ab" for true { s = s + s }`, mini.ErrorValue},
+		{`s = "ab" for true { s = s.replace("a", s) }`, mini.ErrorValue},
+	}
+	for _, backend := range backends {
+		for _, test := range tests {
+			program := test.Program
+			t.Run(backend.Name+"/"+program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				vm.MaxSteps = 1000
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				start := time.Now()
+				err := vm.EvalContext(ctx, strings.NewReader(program))
+				if elapsed := time.Since(start); elapsed > 2*time.Second {
+					t.Errorf("expected the evaluation to stop within its deadline, took %v", elapsed)
+				}
+				if e, ok := err.(*mini.Error); !ok || e.Kind != test.Kind {
+					t.Errorf("expected a %v, got %v", test.Kind, err)
+				}
+			})
+		}
+	}
+}
+
+func TestVmMemoryLimit(t *testing.T) {
+	for _, backend := range backends {
+		for _, program := range []string{
+			`s = "ab" for true { s = s + s }`,
+			"xs = [] for true { xs.push(1) }",
+			"xs = [1] for true { xs = xs + xs }",
+			"m = {} i = 0 for true { m[i] = i i = i + 1 }",
+			`xs = "a,b".split(",") for true { xs.push(xs) }`,
+			"for true { log.push(1) }",
+			"x = 3n for true { x = x * x }",
+			"2n ** 100000000000n",
+			"1.5d ** 100000000000",
+			`try { s = "a" for true { s = s + s } } catch { 1 }`,
+		} {
+			t.Run(backend.Name+"/"+program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				vm.MaxAlloc = 1 << 20
+				vm.SetGlobal("log", mini.NewList())
+				err := vm.EvalString(program)
+				if err != mini.ErrMemoryLimit {
+					t.Fatalf("expected ErrMemoryLimit, got %v", err)
+				}
+				if allocated := vm.Stats().Allocated; allocated > vm.MaxAlloc {
+					t.Errorf("expected at most %d bytes allocated, got %d", vm.MaxAlloc, allocated)
+				}
+			})
+		}
+	}
+}
+
+func TestVmResultOnError(t *testing.T) {
+	for _, backend := range backends {
+		for _, program := range []string{
+			"x = 1\n1 / 0",
+			"x = 2\nundefined()",
+			`f = func() { 3 raise("boom") } f()`,
+			"x = 4 for true { x }",
+			"1 +",
+		} {
+			t.Run(backend.Name+"/"+program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				vm.MaxSteps = 100
+				if err := vm.EvalString("5"); err != nil {
+					t.Fatal(err)
+				}
+				if err := vm.EvalString(program); err == nil {
+					t.Fatal("expected an error")
+				}
+				if vm.Result != mini.NIL {
+					t.Errorf("expected the result to be nil, got %v", vm.Result)
+				}
+			})
+		}
+	}
+}
+
+func TestVmStats(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend.Name, func(t *testing.T) {
+			vm := mini.NewVm()
+			vm.Backend = backend.Backend
+			if err := vm.EvalString(`f = func(s) { s + "!" } for i in range(10) { f("x") }`); err != nil {
+				t.Fatal(err)
+			}
+			// ten loop iterations, ten calls to f and one to range
+			stats := vm.Stats()
+			if stats.Steps != 21 {
+				t.Errorf("expected 21 steps, got %d", stats.Steps)
+			}
+			if stats.Allocated == 0 {
+				t.Error("expected allocations to be accounted for")
+			}
+			if err := vm.EvalString("1 + 1"); err != nil {
+				t.Fatal(err)
+			}
+			if stats := vm.Stats(); stats != (mini.Stats{}) {
+				t.Errorf("expected the stats to be reset, got %+v", stats)
+			}
+			if err := vm.EvalString(`"a,b".split(",").join("-").upper()`); err != nil {
+				t.Fatal(err)
+			}
+			if steps := vm.Stats().Steps; steps != 3 {
+				t.Errorf("expected calls to native functions to count, got %d steps", steps)
+			}
+			vm.MaxSteps = 2
+			err := vm.EvalString(`"a,b".split(",").join("-").upper()`)
+			if e, ok := err.(*mini.StepLimitError); !ok || e.Limit != 2 {
+				t.Errorf("expected a StepLimitError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVmStatsDecimal(t *testing.T) {
+	for _, backend := range backends {
+		for _, program := range []string{"7.5d % 2d", "7.5d ~/ 2d"} {
+			t.Run(backend.Name+"/"+program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				if err := vm.EvalString(program); err != nil {
+					t.Fatal(err)
+				}
+				if vm.Stats().Allocated == 0 {
+					t.Error("expected the result to be accounted for")
+				}
+			})
+		}
+	}
+}
+
+func TestVmTraceback(t *testing.T) {
+	fail := mini.Function(func(mini.Args) (mini.Object, error) {
+		return nil, errors.New("disk on fire")
+	})
+	tests := []struct {
+		Program  string
+		Expected []string
+	}{
+		{"1 / 0", nil},
+		{
+			"inner = func(x) {\n  1 / x\n}\nouter = func(xs) {\n  for x in xs {\n    inner(x)\n  }\n}\nouter([1, 0])",
+			[]string{"in inner, called at rules.mini:6:10", "in outer, called at rules.mini:9:6"},
+		},
+		{
+			"f = func() { raise(\"boom\") }\nf()",
+			[]string{"in raise, called at rules.mini:1:19", "in f, called at rules.mini:2:2"},
+		},
+		{
+			"f = func() {\n  fail()\n}\nf()",
+			[]string{"in fail, called at rules.mini:2:7", "in f, called at rules.mini:4:2"},
+		},
+		{
+			"f = func(n) { if n == 0 { 1 / 0 } else { f(n - 1) } }\nf(2)",
+			[]string{"in f, called at rules.mini:1:43", "in f, called at rules.mini:1:43", "in f, called at rules.mini:2:2"},
+		},
+		{
+			"g = [func() { 1 / 0 }]\nf = func() { g[0]() }\nf()",
+			[]string{"in <anonymous>, called at rules.mini:2:18", "in f, called at rules.mini:3:2"},
+		},
+		{
+			"f = func() { 1 / 0 }\ntry { f() } catch e { raise(e) }",
+			[]string{"in f, called at rules.mini:2:8"},
+		},
+	}
+	for _, backend := range backends {
+		for _, test := range tests {
+			t.Run(backend.Name+"/"+test.Program, func(t *testing.T) {
+				vm := mini.NewVm()
+				vm.Backend = backend.Backend
+				vm.SetGlobal("fail", fail)
+				// a failed evaluation must not leave calls behind
+				if vm.EvalString("h = func() { 1 / 0 }\nh()") == nil {
+					t.Fatal("expected an error")
+				}
+				err := vm.EvalFile("rules.mini", strings.NewReader(test.Program))
+				e, ok := err.(*mini.Error)
+				if !ok {
+					t.Fatalf("expected a *mini.Error, got %v", err)
+				}
+				var trace []string
+				for _, f := range e.Trace {
+					trace = append(trace, f.String())
+				}
+				if !reflect.DeepEqual(trace, test.Expected) {
+					t.Errorf("expected %q, got %q", test.Expected, trace)
+				}
+			})
+		}
+	}
+}
+
+func TestVmTracebackPositions(t *testing.T) {
+	program := "bottom = func() { raise(\"x\") }\nmiddle = func() {\n  bottom()\n}\n  middle()"
+	expected := []mini.Position{pos(0, 23), pos(2, 8), pos(4, 8)}
+	for _, backend := range backends {
+		t.Run(backend.Name, func(t *testing.T) {
+			vm := mini.NewVm()
+			vm.Backend = backend.Backend
+			err := vm.EvalString(program)
+			e, ok := err.(*mini.Error)
+			if !ok {
+				t.Fatalf("expected a *mini.Error, got %v", err)
+			}
+			var positions []mini.Position
+			for _, f := range e.Trace {
+				positions = append(positions, f.Pos)
+			}
+			if !reflect.DeepEqual(positions, expected) {
+				t.Errorf("expected frames at %v, got %v", expected, positions)
+			}
+			// the error is reported where the innermost frame says
+			if e.Pos != expected[0] {
+				t.Errorf("expected the error at %v, got %v", expected[0], e.Pos)
+			}
+		})
+	}
+}
+
+func TestVmHostFunctionError(t *testing.T) {
+	cause := errors.New("disk on fire")
+	vm := mini.NewVm()
+	vm.SetGlobal("fail", mini.Function(func(mini.Args) (mini.Object, error) {
+		return nil, cause
+	}))
+	err := vm.EvalFile("rules.mini", strings.NewReader("x = 1\nfail()"))
+	e, ok := err.(*mini.Error)
+	if !ok {
+		t.Fatalf("expected a *mini.Error, got %v", err)
+	}
+	if mini.Cause(err) != cause {
+		t.Errorf("expected the host error as the cause, got %v", mini.Cause(err))
+	}
+	if s, expected := e.Error(), "disk on fire at rules.mini:2:5"; s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+	if s, expected := e.Traceback(), "in fail, called at rules.mini:2:5\n"; s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+	err = vm.EvalString("f = func() { fail() }\ntry { f() } catch e { e.traceback() }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, expected := vm.Result, mini.String("in fail, called at 1:18\nin f, called at 2:8\n"); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+}
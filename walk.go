@@ -0,0 +1,229 @@
+package mini
+
+// Node is implemented by the AST nodes, which may have subexpressions. Every
+// node the parser produces is a Node.
+type Node interface {
+	Expression
+	// Children returns the subexpressions of the node in source order,
+	// leaving out any which are absent
+	Children() []Expression
+}
+
+// Visitor is called by Walk for each expression in an AST. If Visit returns a
+// non-nil Visitor w, Walk visits the children of the expression with w, then
+// calls w.Visit(nil).
+type Visitor interface {
+	Visit(expr Expression) (w Visitor)
+}
+
+// Walk traverses the AST rooted at expr in depth-first order, starting with
+// v.Visit(expr)
+func Walk(expr Expression, v Visitor) {
+	if v = v.Visit(expr); v == nil {
+		return
+	}
+	if n, ok := expr.(Node); ok {
+		for _, child := range n.Children() {
+			Walk(child, v)
+		}
+	}
+	v.Visit(nil)
+}
+
+// Rewrite replaces each expression in the AST rooted at expr with the result
+// of calling f on it, children first, and returns the new root. The nodes are
+// updated in place. If f returns nil for an expression in a Tree or Block, it
+// is removed, and if it returns anything other than a *Block for a block, the
+// result is wrapped in one.
+func Rewrite(expr Expression, f func(Expression) Expression) Expression {
+	if expr == nil {
+		return nil
+	}
+	switch e := expr.(type) {
+	case *Tree:
+		e.Exprs = rewriteSequence(e.Exprs, f)
+	case *Block:
+		e.Exprs = rewriteSequence(e.Exprs, f)
+	case *IfExpr:
+		rewriteConditional(&e.If, f)
+		rewriteConditional(&e.Else, f)
+	case *ForExpr:
+		rewriteConditional(&e.For, f)
+	case *ForInExpr:
+		e.Iter = Rewrite(e.Iter, f)
+		e.Body = rewriteBlock(e.Body, f)
+	case *TryExpr:
+		e.Body = rewriteBlock(e.Body, f)
+		e.Catch = rewriteBlock(e.Catch, f)
+		e.Finally = rewriteBlock(e.Finally, f)
+	case *AssignExpr:
+		e.Expr = Rewrite(e.Expr, f)
+	case *CallExpr:
+		e.Func = Rewrite(e.Func, f)
+		rewriteEach(e.Args, f)
+	case *SelectorExpr:
+		e.Base = Rewrite(e.Base, f)
+	case *FuncExpr:
+		e.Body = rewriteBlock(e.Body, f)
+	case *ReturnExpr:
+		e.Expr = Rewrite(e.Expr, f)
+	case *ListExpr:
+		rewriteEach(e.Items, f)
+	case *MapExpr:
+		for i := range e.Keys {
+			e.Keys[i] = Rewrite(e.Keys[i], f)
+			e.Values[i] = Rewrite(e.Values[i], f)
+		}
+	case *NotExpr:
+		e.Expr = Rewrite(e.Expr, f)
+	case *AndExpr:
+		e.LHS = Rewrite(e.LHS, f)
+		e.RHS = Rewrite(e.RHS, f)
+	case *OrExpr:
+		e.LHS = Rewrite(e.LHS, f)
+		e.RHS = Rewrite(e.RHS, f)
+	case *OpExpr:
+		e.Base = Rewrite(e.Base, f)
+		rewriteEach(e.Args, f)
+	}
+	return f(expr)
+}
+
+func rewriteEach(exprs []Expression, f func(Expression) Expression) {
+	for i, expr := range exprs {
+		exprs[i] = Rewrite(expr, f)
+	}
+}
+
+// rewriteSequence rewrites the expressions of a Tree or Block, dropping any
+// which are rewritten to nil
+func rewriteSequence(exprs []Expression, f func(Expression) Expression) []Expression {
+	out := exprs[:0]
+	for _, expr := range exprs {
+		if expr = Rewrite(expr, f); expr != nil {
+			out = append(out, expr)
+		}
+	}
+	return out
+}
+
+func rewriteConditional(cb *ConditionalBlock, f func(Expression) Expression) {
+	cb.Condition = Rewrite(cb.Condition, f)
+	cb.Block = Rewrite(cb.Block, f)
+}
+
+// rewriteBlock rewrites a block which must remain a *Block
+func rewriteBlock(b *Block, f func(Expression) Expression) *Block {
+	if b == nil {
+		return nil
+	}
+	switch e := Rewrite(b, f).(type) {
+	case *Block:
+		return e
+	case nil:
+		return &Block{Span: b.Span}
+	default:
+		return &Block{Span: SpanOf(e), Exprs: []Expression{e}}
+	}
+}
+
+// children collects the given subexpressions, leaving out any which are nil
+func children(exprs ...Expression) []Expression {
+	var out []Expression
+	for _, expr := range exprs {
+		if expr != nil {
+			out = append(out, expr)
+		}
+	}
+	return out
+}
+
+// blockChild returns b as an Expression, or nil if b is nil
+func blockChild(b *Block) Expression {
+	if b == nil {
+		return nil
+	}
+	return b
+}
+
+// Children helps Tree implement the Node interface
+func (e *Tree) Children() []Expression { return children(e.Exprs...) }
+
+// Children helps Block implement the Node interface
+func (e *Block) Children() []Expression { return children(e.Exprs...) }
+
+// Children helps IfExpr implement the Node interface
+func (e *IfExpr) Children() []Expression {
+	return children(e.If.Condition, e.If.Block, e.Else.Condition, e.Else.Block)
+}
+
+// Children helps ForExpr implement the Node interface
+func (e *ForExpr) Children() []Expression {
+	return children(e.For.Condition, e.For.Block)
+}
+
+// Children helps ForInExpr implement the Node interface
+func (e *ForInExpr) Children() []Expression {
+	return children(e.Iter, blockChild(e.Body))
+}
+
+// Children helps TryExpr implement the Node interface
+func (e *TryExpr) Children() []Expression {
+	return children(blockChild(e.Body), blockChild(e.Catch), blockChild(e.Finally))
+}
+
+// Children helps BreakExpr implement the Node interface
+func (e *BreakExpr) Children() []Expression { return nil }
+
+// Children helps ContinueExpr implement the Node interface
+func (e *ContinueExpr) Children() []Expression { return nil }
+
+// Children helps AssignExpr implement the Node interface
+func (e *AssignExpr) Children() []Expression { return children(e.Expr) }
+
+// Children helps CallExpr implement the Node interface
+func (e *CallExpr) Children() []Expression {
+	return children(append([]Expression{e.Func}, e.Args...)...)
+}
+
+// Children helps SelectorExpr implement the Node interface
+func (e *SelectorExpr) Children() []Expression { return children(e.Base) }
+
+// Children helps FuncExpr implement the Node interface
+func (e *FuncExpr) Children() []Expression { return children(blockChild(e.Body)) }
+
+// Children helps ReturnExpr implement the Node interface
+func (e *ReturnExpr) Children() []Expression { return children(e.Expr) }
+
+// Children helps ListExpr implement the Node interface
+func (e *ListExpr) Children() []Expression { return children(e.Items...) }
+
+// Children helps MapExpr implement the Node interface. Each key is followed
+// by its value.
+func (e *MapExpr) Children() []Expression {
+	exprs := make([]Expression, 0, 2*len(e.Keys))
+	for i, key := range e.Keys {
+		exprs = append(exprs, key, e.Values[i])
+	}
+	return children(exprs...)
+}
+
+// Children helps Ident implement the Node interface
+func (e *Ident) Children() []Expression { return nil }
+
+// Children helps Literal implement the Node interface
+func (e *Literal) Children() []Expression { return nil }
+
+// Children helps NotExpr implement the Node interface
+func (e *NotExpr) Children() []Expression { return children(e.Expr) }
+
+// Children helps AndExpr implement the Node interface
+func (e *AndExpr) Children() []Expression { return children(e.LHS, e.RHS) }
+
+// Children helps OrExpr implement the Node interface
+func (e *OrExpr) Children() []Expression { return children(e.LHS, e.RHS) }
+
+// Children helps OpExpr implement the Node interface
+func (e *OpExpr) Children() []Expression {
+	return children(append([]Expression{e.Base}, e.Args...)...)
+}
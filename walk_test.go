@@ -0,0 +1,200 @@
+package mini_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jncornett/mini"
+)
+
+func parse(t *testing.T, src string) mini.Expression {
+	expr, err := mini.NewParser(strings.NewReader(src)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+// identCollector records the names of the identifiers it visits, without
+// descending into function literals
+type identCollector struct {
+	names []string
+}
+
+func (c *identCollector) Visit(expr mini.Expression) mini.Visitor {
+	switch e := expr.(type) {
+	case *mini.Ident:
+		c.names = append(c.names, string(e.Name))
+	case *mini.FuncExpr:
+		return nil
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	tests := []struct {
+		Program  string
+		Expected []string
+	}{
+		{"a + b * c", []string{"a", "b", "c"}},
+		{"if a { b } else { c }", []string{"a", "b", "c"}},
+		{"for k, v in m { f(k, v) }", []string{"m", "f", "k", "v"}},
+		{"try { a } catch e { b } finally { c }", []string{"a", "b", "c"}},
+		{"x = {a: b, c: [d, !e]}", []string{"a", "b", "c", "d", "e"}},
+		{"a.b(c)[d] = e", []string{"a", "c", "d", "e"}},
+		{"f = func(x) { x }\ng(f)", []string{"g", "f"}},
+		{"for a and b or c { return d }", []string{"a", "b", "c", "d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			c := &identCollector{}
+			mini.Walk(parse(t, test.Program), c)
+			if fmt.Sprint(c.names) != fmt.Sprint(test.Expected) {
+				t.Errorf("expected %v, got %v", test.Expected, c.names)
+			}
+		})
+	}
+}
+
+// depthRecorder checks that each visit to a child is matched by a visit to
+// nil once its children are done
+type depthRecorder struct {
+	depth, max int
+}
+
+func (r *depthRecorder) Visit(expr mini.Expression) mini.Visitor {
+	if expr == nil {
+		r.depth--
+		return nil
+	}
+	r.depth++
+	if r.depth > r.max {
+		r.max = r.depth
+	}
+	return r
+}
+
+func TestWalkDepth(t *testing.T) {
+	r := &depthRecorder{}
+	mini.Walk(parse(t, "f(g(h(1)))"), r)
+	if r.depth != 0 || r.max != 5 {
+		t.Errorf("expected to return to depth 0 from depth 5, got %d from %d", r.depth, r.max)
+	}
+}
+
+func TestChildren(t *testing.T) {
+	tests := []struct {
+		Program  string
+		Expected string
+	}{
+		{"1 + 2", "[1 2]"},
+		{"f(a, b)", "[@f @a @b]"},
+		{"xs[0]", "[@xs 0]"},
+		{"!a", "[@a]"},
+		{"a.b", "[@a]"},
+		{"x = 1", "[1]"},
+		{"[1, 2]", "[1 2]"},
+		{"{1: 2, 3: 4}", "[1 2 3 4]"},
+		{"if a { 1 }", "[@a Block[1]]"},
+		{"if a { 1 } else { 2 }", "[@a Block[1] true Block[2]]"},
+		{"for { 1 }", "[true Block[1]]"},
+		{"for x in xs { x }", "[@xs Block[@x]]"},
+		{"try { 1 } finally { 2 }", "[Block[1] Block[2]]"},
+		{"func(x) { x }", "[Block[@x]]"},
+		{"for { break }", "[true Block[Break]]"},
+		{"func() { return }", "[Block[Return]]"},
+		{"a", "[]"},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			tree := parse(t, test.Program).(*mini.Tree)
+			node, ok := tree.Exprs[0].(mini.Node)
+			if !ok {
+				t.Fatalf("expected a Node, got %T", tree.Exprs[0])
+			}
+			if s := fmt.Sprint(node.Children()); s != test.Expected {
+				t.Errorf("expected %s, got %s", test.Expected, s)
+			}
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	rename := func(expr mini.Expression) mini.Expression {
+		if ident, ok := expr.(*mini.Ident); ok && ident.Name == "x" {
+			return &mini.Ident{Span: ident.Span, Name: "y"}
+		}
+		return expr
+	}
+	// fold replaces additions of two literals with their sum
+	fold := func(expr mini.Expression) mini.Expression {
+		op, ok := expr.(*mini.OpExpr)
+		if !ok || op.Op != mini.OpAdd {
+			return expr
+		}
+		lhs, lok := op.Base.(*mini.Literal)
+		rhs, rok := op.Args[0].(*mini.Literal)
+		if !lok || !rok {
+			return expr
+		}
+		sum, err := lhs.Value.Send(mini.OpAdd, mini.Args{rhs.Value})
+		if err != nil {
+			return expr
+		}
+		return &mini.Literal{Span: op.Span, Value: sum}
+	}
+	// dropLog removes calls of log
+	dropLog := func(expr mini.Expression) mini.Expression {
+		if call, ok := expr.(*mini.CallExpr); ok {
+			if ident, ok := call.Func.(*mini.Ident); ok && ident.Name == "log" {
+				return nil
+			}
+		}
+		return expr
+	}
+	// unwrap replaces blocks of a single expression with the expression
+	unwrap := func(expr mini.Expression) mini.Expression {
+		if b, ok := expr.(*mini.Block); ok && len(b.Exprs) == 1 {
+			return b.Exprs[0]
+		}
+		return expr
+	}
+	tests := []struct {
+		Program  string
+		Rewrite  func(mini.Expression) mini.Expression
+		Expected string
+	}{
+		{"x + f(x, z)", rename, "Tree[Op{add}[@y @f[@y @z]]]"},
+		{"for x in xs { x }", rename, "Tree[ForIn(@x in @xs Block[@y])]"},
+		{"a = 1 + 2 * (3 + 4)", fold, "Tree[@a=Op{add}[1 Op{mul}[2 Tree[7]]]]"},
+		{"[1 + 2, 3 + 4 + 5]", fold, "Tree[List[3 12]]"},
+		{"log(1)\nx = 2\nif x { log(x) }", dropLog, "Tree[@x=2 If(Cond(@x=>Block[]) Cond(<nil>=><nil>))]"},
+		{"try { 1 } catch { 2 }", unwrap, "Tree[Try(Block[1] Catch(Block[2]))]"},
+		{"try { } catch { log(1) }", dropLog, "Tree[Try(Block[] Catch(Block[]))]"},
+	}
+	for _, test := range tests {
+		t.Run(test.Program, func(t *testing.T) {
+			expr := mini.Rewrite(parse(t, test.Program), test.Rewrite)
+			if s := fmt.Sprint(expr); s != test.Expected {
+				t.Errorf("expected %s, got %s", test.Expected, s)
+			}
+		})
+	}
+}
+
+func TestRewriteEval(t *testing.T) {
+	expr := mini.Rewrite(parse(t, "x = 1\ny = x + 41"), func(expr mini.Expression) mini.Expression {
+		if lit, ok := expr.(*mini.Literal); ok && lit.Value == mini.Int(1) {
+			return &mini.Literal{Span: lit.Span, Value: mini.Int(2)}
+		}
+		return expr
+	})
+	vm := mini.NewVm()
+	if _, err := expr.Eval(vm); err != nil {
+		t.Fatal(err)
+	}
+	if y := vm.Global("y"); y != mini.Int(43) {
+		t.Errorf("expected 43, got %v", y)
+	}
+}